@@ -0,0 +1,60 @@
+// accessible.go
+package main
+
+import "fmt"
+
+// OverflowRule decides, from the lot's current occupancy, whether free
+// accessible slots may be released to cars without a handicap permit.
+type OverflowRule func(occupied, capacity int) bool
+
+// OverflowAbove releases accessible slots once more than the given
+// fraction of the lot is occupied, e.g. OverflowAbove(0.95).
+func OverflowAbove(fraction float64) OverflowRule {
+	return func(occupied, capacity int) bool {
+		return capacity > 0 && float64(occupied) > fraction*float64(capacity)
+	}
+}
+
+// SetAccessible flags the given slot numbers as accessible; the flag on
+// every other slot is cleared.
+func (pl *ParkingLot) SetAccessible(numbers ...int) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	want := make(map[int]bool, len(numbers))
+	for _, n := range numbers {
+		want[n] = true
+	}
+	for i := range pl.Slots {
+		delete(want, pl.Slots[i].Number)
+	}
+	for n := range want {
+		return &LotError{Lot: pl.Name, Err: fmt.Errorf("%w %d", ErrUnknownSlot, n)}
+	}
+	for i := range pl.Slots {
+		pl.Slots[i].Accessible = false
+	}
+	for _, n := range numbers {
+		for i := range pl.Slots {
+			if pl.Slots[i].Number == n {
+				pl.Slots[i].Accessible = true
+			}
+		}
+	}
+	pl.idx = nil // free slots are indexed by their accessible flag
+	return pl.persistLocked()
+}
+
+func (pl *ParkingLot) SetAccessibleOverflow(rule OverflowRule) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.AccessibleOverflow = rule
+}
+
+func (pl *ParkingLot) accessibleReleasedLocked() bool {
+	if pl.AccessibleOverflow == nil {
+		return false
+	}
+	occupied := len(pl.Slots) - pl.indexLocked().total
+	return pl.AccessibleOverflow(occupied, len(pl.Slots))
+}
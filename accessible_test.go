@@ -0,0 +1,57 @@
+// accessible_test.go
+package main
+
+import "testing"
+
+func TestAccessibleSlotsAreKeptForHandicapDrivers(t *testing.T) {
+	lot := NewParkingLot("Lot A", 3)
+	if err := lot.SetAccessible(1); err != nil {
+		t.Fatal(err)
+	}
+
+	slot, err := lot.ParkCar(&Car{Number: "GEN1"})
+	if err != nil || slot != 2 {
+		t.Fatalf("expected general car to skip accessible slot 1, got %d (err %v)", slot, err)
+	}
+
+	attendant := &Attendant{Name: "Meera", Lot: lot}
+	slot, err = attendant.ParkCarForDriver(&Car{Number: "HC1", IsHandicap: true})
+	if err != nil || slot != 1 {
+		t.Fatalf("expected handicap car in accessible slot 1, got %d (err %v)", slot, err)
+	}
+
+	// With the accessible slot taken a handicap driver uses general slots.
+	slot, err = lot.ParkCar(&Car{Number: "HC2", IsHandicap: true})
+	if err != nil || slot != 3 {
+		t.Errorf("expected second handicap car in slot 3, got %d (err %v)", slot, err)
+	}
+}
+
+func TestAccessibleOverflowReleasesSlotsWhenNearlyFull(t *testing.T) {
+	lot := NewParkingLot("Lot A", 4)
+	_ = lot.SetAccessible(4)
+	lot.SetAccessibleOverflow(OverflowAbove(0.5))
+
+	parkAll(t, lot, "G1", "G2")
+	if _, err := lot.ParkCar(&Car{Number: "G3"}); err != nil {
+		t.Fatalf("expected slot 3 to be free for G3: %v", err)
+	}
+	// 3 of 4 occupied is above 50%, so the accessible slot is released.
+	slot, err := lot.ParkCar(&Car{Number: "G4"})
+	if err != nil || slot != 4 {
+		t.Errorf("expected released accessible slot 4, got %d (err %v)", slot, err)
+	}
+}
+
+func TestAccessibleSlotRefusedWithoutOverflowRule(t *testing.T) {
+	lot := NewParkingLot("Lot A", 2)
+	_ = lot.SetAccessible(2)
+	parkAll(t, lot, "G1")
+
+	if _, err := lot.ParkCar(&Car{Number: "G2"}); err == nil {
+		t.Error("expected general car to be refused the accessible slot")
+	}
+	if err := lot.SetAccessible(9); err == nil {
+		t.Error("expected error for unknown slot number")
+	}
+}
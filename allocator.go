@@ -0,0 +1,159 @@
+// allocator.go
+package main
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+// SlotAllocator picks where a car goes. The lot passes the free slots the
+// car fits, in slot-number order; Choose returns an index into free, or -1
+// to refuse the car.
+type SlotAllocator interface {
+	Choose(free []Slot, car *Car) int
+}
+
+// FirstFreeAllocator takes the lowest-numbered free slot. It is the
+// default for every lot.
+type FirstFreeAllocator struct{}
+
+var DefaultAllocator SlotAllocator = FirstFreeAllocator{}
+
+func (FirstFreeAllocator) Choose(free []Slot, car *Car) int {
+	if len(free) == 0 {
+		return -1
+	}
+	return 0
+}
+
+// NearestToExitAllocator takes the free slot whose number is closest to
+// the exit slot number.
+type NearestToExitAllocator struct {
+	Exit int
+}
+
+func (a NearestToExitAllocator) Choose(free []Slot, car *Car) int {
+	best, bestDist := -1, 0
+	for i, slot := range free {
+		dist := slot.Number - a.Exit
+		if dist < 0 {
+			dist = -dist
+		}
+		if best < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// FarthestFirstAllocator fills the lot from the highest slot number down,
+// keeping the slots near the entrance free for as long as possible.
+type FarthestFirstAllocator struct{}
+
+func (FarthestFirstAllocator) Choose(free []Slot, car *Car) int {
+	return len(free) - 1
+}
+
+// FillByRowAllocator fills rows in the given order before moving on; rows
+// not listed are used last.
+type FillByRowAllocator struct {
+	Rows []string
+}
+
+func (a FillByRowAllocator) Choose(free []Slot, car *Car) int {
+	best, bestRank := -1, 0
+	for i, slot := range free {
+		rank := len(a.Rows)
+		for r, row := range a.Rows {
+			if slot.Row == row {
+				rank = r
+				break
+			}
+		}
+		if best < 0 || rank < bestRank {
+			best, bestRank = i, rank
+		}
+	}
+	return best
+}
+
+// RandomSpreadAllocator picks a free slot uniformly at random so wear and
+// traffic spread across the lot.
+type RandomSpreadAllocator struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func NewRandomSpreadAllocator(seed uint64) *RandomSpreadAllocator {
+	return &RandomSpreadAllocator{rnd: rand.New(rand.NewPCG(seed, seed))}
+}
+
+func (a *RandomSpreadAllocator) Choose(free []Slot, car *Car) int {
+	if len(free) == 0 {
+		return -1
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rnd.IntN(len(free))
+}
+
+// HandicapReservedAllocator keeps the Reserved slot numbers for handicap
+// drivers: they get a reserved slot when one is free, everyone else is
+// only offered the remaining slots. Fallback orders both groups and
+// defaults to DefaultAllocator.
+type HandicapReservedAllocator struct {
+	Reserved []int
+	Fallback SlotAllocator
+}
+
+func (a HandicapReservedAllocator) Choose(free []Slot, car *Car) int {
+	fallback := a.Fallback
+	if fallback == nil {
+		fallback = DefaultAllocator
+	}
+
+	var reserved, general []Slot
+	var reservedIdx, generalIdx []int
+	for i, slot := range free {
+		if a.isReserved(slot.Number) {
+			reserved = append(reserved, slot)
+			reservedIdx = append(reservedIdx, i)
+		} else {
+			general = append(general, slot)
+			generalIdx = append(generalIdx, i)
+		}
+	}
+
+	if car.IsHandicap && len(reserved) > 0 {
+		if i := fallback.Choose(reserved, car); i >= 0 {
+			return reservedIdx[i]
+		}
+	}
+	if i := fallback.Choose(general, car); i >= 0 {
+		return generalIdx[i]
+	}
+	return -1
+}
+
+func (a HandicapReservedAllocator) isReserved(number int) bool {
+	for _, n := range a.Reserved {
+		if n == number {
+			return true
+		}
+	}
+	return false
+}
+
+// BestFitAllocator takes the smallest free slot the car fits, so large
+// slots stay available for large vehicles.
+type BestFitAllocator struct{}
+
+func (BestFitAllocator) Choose(free []Slot, car *Car) int {
+	best := -1
+	for i, slot := range free {
+		if best < 0 || slotClass(slot.Size).rank() < slotClass(free[best].Size).rank() {
+			best = i
+		}
+	}
+	return best
+}
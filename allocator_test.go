@@ -0,0 +1,92 @@
+// allocator_test.go
+package main
+
+import "testing"
+
+func parkAll(t *testing.T, lot *ParkingLot, plates ...string) []int {
+	t.Helper()
+	var slots []int
+	for _, plate := range plates {
+		slot, err := lot.ParkCar(&Car{Number: plate})
+		if err != nil {
+			t.Fatalf("failed to park %s: %v", plate, err)
+		}
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+func TestLotAllocators(t *testing.T) {
+	cases := []struct {
+		name      string
+		allocator SlotAllocator
+		want      []int
+	}{
+		{"default", nil, []int{1, 2, 3}},
+		{"nearest to exit", NearestToExitAllocator{Exit: 4}, []int{4, 3, 5}},
+		{"farthest first", FarthestFirstAllocator{}, []int{5, 4, 3}},
+		{"fill by row", FillByRowAllocator{Rows: []string{"C", "A"}}, []int{3, 1, 2}},
+	}
+	for _, tc := range cases {
+		lot := NewParkingLot("Lot A", 5)
+		lot.SetAllocator(tc.allocator)
+		got := parkAll(t, lot, "P1", "P2", "P3")
+		for i := range tc.want {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: expected slots %v, got %v", tc.name, tc.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestRandomSpreadAllocatorUsesEverySlotOnce(t *testing.T) {
+	lot := NewParkingLot("Lot A", 6)
+	lot.SetAllocator(NewRandomSpreadAllocator(7))
+
+	seen := make(map[int]bool)
+	for _, slot := range parkAll(t, lot, "R1", "R2", "R3", "R4", "R5", "R6") {
+		if seen[slot] {
+			t.Fatalf("slot %d handed out twice", slot)
+		}
+		seen[slot] = true
+	}
+}
+
+func TestHandicapReservedAllocatorPerAttendant(t *testing.T) {
+	lot := NewParkingLot("Lot A", 3)
+	attendant := &Attendant{Name: "Asha", Lot: lot, Allocator: HandicapReservedAllocator{Reserved: []int{1}}}
+
+	slot, err := attendant.ParkCarWithStrategy(&Car{Number: "GEN1"})
+	if err != nil || slot != 2 {
+		t.Fatalf("expected general car in slot 2, got %d (err %v)", slot, err)
+	}
+	slot, err = attendant.ParkCarWithStrategy(&Car{Number: "HC1", IsHandicap: true})
+	if err != nil || slot != 1 {
+		t.Fatalf("expected handicap car in reserved slot 1, got %d (err %v)", slot, err)
+	}
+	_, _ = attendant.ParkCarWithStrategy(&Car{Number: "GEN2"})
+	if _, err := lot.UnparkCar("HC1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := attendant.ParkCarWithStrategy(&Car{Number: "GEN3"}); err == nil {
+		t.Error("expected general car to be refused when only the reserved slot is free")
+	}
+
+	// The lot's own allocator is untouched by the attendant's choice.
+	if slot, err := lot.ParkCar(&Car{Number: "WALKIN"}); err != nil || slot != 1 {
+		t.Errorf("expected walk-in through the lot default to get slot 1, got %d (err %v)", slot, err)
+	}
+}
+
+func TestBestFitAllocatorKeepsLargeSlotsFree(t *testing.T) {
+	lot := NewParkingLotWithSizes("Lot A", SizeLarge, SizeRegular, SizeCompact)
+	lot.SetAllocator(BestFitAllocator{})
+
+	if slot, _ := lot.ParkCar(&Car{Number: "C1", Size: SizeCompact}); slot != 3 {
+		t.Errorf("expected compact car in the compact slot 3, got %d", slot)
+	}
+	if slot, _ := lot.ParkCar(&Car{Number: "C2", Size: SizeCompact}); slot != 2 {
+		t.Errorf("expected next compact car in the regular slot 2, got %d", slot)
+	}
+}
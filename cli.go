@@ -0,0 +1,843 @@
+// cli.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit codes of the subcommands, so scripts can tell failures apart.
+const (
+	exitOK           = 0
+	exitError        = 1 // I/O and other unexpected failures
+	exitUsage        = 2 // bad arguments
+	exitNotFound     = 3 // unknown plate, lot or ticket
+	exitConflict     = 4 // lot full, plate already parked, ticket used
+	exitIncompatible = 5 // vehicle does not fit, ticket for another car
+	exitDeclined     = 6 // payment declined
+)
+
+const cliUsage = `usage: parkinglot [-data dir] [-config file] <command> [flags]
+
+commands:
+  park <plate> [-lot name] [-color c] [-make m] [-size s] [-handicap] [-attendant name]
+  unpark <plate> [-lot name]
+  charge <plate> [-lot name] [-lost] [-pay method] | charge -ticket id [-plate plate] [-lot name] [-pay method]
+  receipts <plate> | receipts -ticket id
+  refund <ticket> [-amount n] [-reason text]
+  find <plate>
+  search [-color c] [-make m] [-size s] [-handicap true|false] [-within 30m]
+  status [lot]
+  lots list
+  lots create <name> -slots n [-sizes s,s,...] [-accessible 1,2] [-bus-span n]
+  report [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-date YYYY-MM-DD] [-csv lots|attendants|hourly]
+  reserve <plate> -start 2024-03-04T09:00 [-for 2h] [-size s] [-slot n] [-lot name]
+  reservations [lot] | reservations cancel <id> -lot name
+  passes [list] | passes remove <plate>
+  passes add <plate> -until YYYY-MM-DD [-from YYYY-MM-DD] [-lots a,b] [-slot n] [-discount 100] [-holder name]
+
+every command accepts -json; without a command the interactive menu starts.
+`
+
+// state is the lot state on disk shared by the menu, the API server and
+// the subcommands: lot snapshots in a FileStore, with the journal and the
+// pass registry beside it.
+type state struct {
+	manager *ParkingManager
+	store   *FileStore
+	journal *Journal
+	lock    *os.File // held on dataDir/.lock
+	dataDir string
+
+	attendants map[string][]*Attendant // by lot name, from the config
+	payments   PaymentProcessor
+}
+
+// openState loads the saved lots and, when configPath is set, builds or
+// updates the lots the config file describes. The data directory stays
+// locked until the state is closed, so concurrent runs take turns rather
+// than overwrite each other's snapshots and journal entries.
+func openState(dataDir, configPath string) (*state, error) {
+	return loadState(dataDir, configPath, false)
+}
+
+// openReadOnlyState is openState for commands that only read the lots. It
+// goes on without the journal if that cannot be opened, so a damaged
+// journal does not stop them.
+func openReadOnlyState(dataDir, configPath string) (*state, error) {
+	return loadState(dataDir, configPath, true)
+}
+
+func loadState(dataDir, configPath string, readOnly bool) (_ *state, err error) {
+	store, err := NewFileStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := lockDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.Close()
+		}
+	}()
+	manager, err := LoadParkingManager(store)
+	if err != nil {
+		return nil, err
+	}
+	passes, err := LoadPasses(filepath.Join(dataDir, "passes.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	manager.SetPasses(passes)
+	// Card, UPI and wallet payments go to the in-process mock gateway until
+	// a real one is wired in.
+	s := &state{manager: manager, store: store, lock: lock, dataDir: dataDir, payments: &MockGateway{}}
+	for _, lot := range manager.lots() {
+		lot.SetPayments(s.payments)
+	}
+	if configPath != "" {
+		cfg, err := LoadConfig(configPath)
+		if err == nil {
+			err = s.applyConfig(cfg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	journal, err := OpenJournal(filepath.Join(dataDir, "journal.jsonl"))
+	if err != nil {
+		if readOnly {
+			return s, nil
+		}
+		return nil, err
+	}
+	s.journal = journal
+	// Saved lots join the journal after the config so a layout it changed
+	// is journaled.
+	if err := manager.SetJournal(journal); err != nil {
+		journal.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// addLot saves a new lot and starts journaling it.
+func (s *state) addLot(lot *ParkingLot) error {
+	if _, err := s.manager.Lot(lot.Name); err == nil {
+		return &LotError{Lot: lot.Name, Err: ErrLotExists}
+	}
+	if err := lot.SetStore(s.store); err != nil {
+		return err
+	}
+	if s.journal != nil { // lots the config adds are journaled once it is open
+		if err := lot.SetJournal(s.journal); err != nil {
+			return err
+		}
+	}
+	lot.SetPayments(s.payments)
+	s.manager.AddLot(lot)
+	return nil
+}
+
+func (s *state) close() {
+	if s.journal != nil {
+		s.journal.Close()
+	}
+	s.lock.Close()
+}
+
+type cli struct {
+	state  *state
+	json   bool
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// runCLI runs one subcommand against the state in dataDir and returns the
+// process exit code.
+func runCLI(dataDir, configPath string, args []string, stdout, stderr io.Writer) int {
+	commands := map[string]func(*cli, []string) error{
+		"park":   (*cli).park,
+		"unpark": (*cli).unpark,
+		"charge": (*cli).charge,
+		"find":   (*cli).find,
+		"search": (*cli).search,
+		"status": (*cli).status,
+		"lots":   (*cli).lots,
+		"report": (*cli).report,
+
+		"reserve":      (*cli).reserve,
+		"reservations": (*cli).reservations,
+		"passes":       (*cli).passes,
+		"receipts":     (*cli).receipts,
+		"refund":       (*cli).refund,
+	}
+	c := &cli{stdout: stdout, stderr: stderr}
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(stdout, cliUsage)
+		return exitOK
+	}
+	run, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], cliUsage)
+		return exitUsage
+	}
+
+	open := openState
+	if readOnlyCommand(args) {
+		open = openReadOnlyState
+	}
+	st, err := open(dataDir, configPath)
+	if err != nil {
+		return c.fail(err)
+	}
+	defer st.close()
+	c.state = st
+	if err := run(c, args[1:]); err != nil {
+		return c.fail(err)
+	}
+	return exitOK
+}
+
+// readOnlyCommand reports whether the command in args only reads the lots.
+func readOnlyCommand(args []string) bool {
+	switch args[0] {
+	case "find", "search", "status", "report", "receipts":
+		return true
+	case "lots":
+		return len(args) > 1 && args[1] == "list"
+	case "reservations":
+		return len(args) == 1 || args[1] != "cancel"
+	case "passes":
+		return len(args) == 1 || (args[1] != "add" && args[1] != "remove")
+	}
+	return false
+}
+
+func (c *cli) fail(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if c.json {
+		json.NewEncoder(c.stderr).Encode(map[string]string{"error": err.Error()})
+	} else {
+		fmt.Fprintln(c.stderr, "Error:", err)
+	}
+	return exitCode(err)
+}
+
+func exitCode(err error) int {
+	switch statusFor(err) {
+	case http.StatusBadRequest:
+		return exitUsage
+	case http.StatusNotFound:
+		return exitNotFound
+	case http.StatusConflict:
+		return exitConflict
+	case http.StatusUnprocessableEntity:
+		return exitIncompatible
+	case http.StatusPaymentRequired:
+		return exitDeclined
+	}
+	return exitError
+}
+
+// flags returns a flag set for a subcommand with the shared -json flag.
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.BoolVar(&c.json, "json", false, "print JSON")
+	return fs
+}
+
+// parse accepts flags before and after the positional arguments, so both
+// "park -lot A KA01" and "park KA01 -lot A" work, and checks their count.
+func parse(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, badRequest(err.Error())
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) < minArgs || len(positional) > maxArgs {
+		return nil, badRequest(fmt.Sprintf("%s: wrong number of arguments", fs.Name()))
+	}
+	return positional, nil
+}
+
+// print writes v as JSON with -json and calls text otherwise.
+func (c *cli) print(v any, text func(w io.Writer)) {
+	if c.json {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	text(c.stdout)
+}
+
+// lotFor returns the named lot, or the lot the plate is parked in when no
+// name is given.
+func (c *cli) lotFor(name, plate string) (*ParkingLot, error) {
+	if name != "" {
+		return c.state.manager.Lot(name)
+	}
+	lotName, _, err := c.state.manager.FindCar(plate)
+	if err != nil {
+		return nil, err
+	}
+	return c.state.manager.Lot(lotName)
+}
+
+func (c *cli) park(args []string) error {
+	fs := c.flags("park")
+	lotName := fs.String("lot", "", "lot to park in; default is the lot with the most room")
+	color := fs.String("color", "", "car color")
+	carMake := fs.String("make", "", "car make")
+	size := fs.String("size", "", "motorcycle, compact, regular, large or bus")
+	handicap := fs.Bool("handicap", false, "driver needs an accessible slot")
+	attendant := fs.String("attendant", "", "attendant parking the car")
+	pos, err := parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	vehicleSize, err := ParseVehicleSize(*size)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+	car := &Car{Number: pos[0], Color: *color, Make: *carMake, Size: vehicleSize, IsHandicap: *handicap}
+
+	var resp parkResponse
+	if *lotName != "" {
+		lot, err := c.state.manager.Lot(*lotName)
+		if err != nil {
+			return err
+		}
+		a, err := c.state.attendant(lot, *attendant)
+		if err != nil {
+			return err
+		}
+		ticket, err := a.ParkCarWithTicket(car)
+		if err != nil {
+			return err
+		}
+		resp = parkResponse{Lot: lot.Name, Slot: ticket.Slot, Ticket: ticket}
+	} else {
+		name, slot, err := c.state.manager.ParkEvenlyWithAttendant(car, *attendant)
+		if err != nil {
+			return err
+		}
+		resp = parkResponse{Lot: name, Slot: slot}
+		if lot, err := c.state.manager.Lot(name); err == nil {
+			resp.Ticket, _ = lot.TicketFor(car.Number)
+		}
+	}
+	c.print(resp, func(w io.Writer) {
+		fmt.Fprintf(w, "Parked %s in %s at slot %d. Ticket: %s\n", car.Number, resp.Lot, resp.Slot, resp.Ticket.ID)
+		if car.Pass != "" {
+			fmt.Fprintf(w, "Monthly pass %s recognized\n", car.Pass)
+		}
+	})
+	return nil
+}
+
+func (c *cli) unpark(args []string) error {
+	fs := c.flags("unpark")
+	lotName := fs.String("lot", "", "lot the car is in; default is wherever it is parked")
+	pos, err := parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	lot, err := c.lotFor(*lotName, pos[0])
+	if err != nil {
+		return err
+	}
+	slot, err := lot.UnparkCar(pos[0])
+	if err != nil {
+		return err
+	}
+	resp := exitResponse{Lot: lot.Name, Slot: slot}
+	c.print(resp, func(w io.Writer) {
+		fmt.Fprintf(w, "Unparked %s from %s slot %d\n", pos[0], lot.Name, slot)
+	})
+	return nil
+}
+
+func (c *cli) charge(args []string) error {
+	fs := c.flags("charge")
+	lotName := fs.String("lot", "", "lot the car is in; default is wherever it is parked")
+	ticketID := fs.String("ticket", "", "ticket presented at the exit")
+	plate := fs.String("plate", "", "plate to check the ticket against")
+	lost := fs.Bool("lost", false, "the driver lost the ticket; adds the penalty")
+	pay := fs.String("pay", "", "cash, card, upi or wallet; the car leaves only once paid")
+	pos, err := parse(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	body := exitBody{Plate: *plate, Ticket: *ticketID, Lost: *lost}
+	if *pay != "" {
+		if body.Method, err = ParsePaymentMethod(*pay); err != nil {
+			return err
+		}
+	}
+	if len(pos) == 1 {
+		body.Plate = pos[0]
+	}
+	if body.Plate == "" && body.Ticket == "" {
+		return badRequest("charge: a plate or -ticket is required")
+	}
+
+	var resp exitResponse
+	switch {
+	case *lotName != "" || body.Plate != "":
+		lot, err := c.lotFor(*lotName, body.Plate)
+		if err != nil {
+			return err
+		}
+		if resp, err = chargeExit(lot, body); err != nil {
+			return err
+		}
+	default:
+		// Only a ticket: it is valid in at most one lot.
+		err = &LotError{Err: fmt.Errorf("%w: %s", ErrInvalidTicket, body.Ticket)}
+		for _, lot := range c.state.manager.lots() {
+			resp, err = chargeExit(lot, body)
+			if !errors.Is(err, ErrInvalidTicket) {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	c.print(resp, func(w io.Writer) {
+		fmt.Fprintf(w, "Unparked %s from %s slot %d\n", resp.Ticket.Plate, resp.Lot, resp.Slot)
+		for _, line := range resp.Quote.Lines {
+			fmt.Fprintf(w, "  %-30s %s\n", line.Description, line.Amount)
+		}
+		fmt.Fprintf(w, "Fee: %s\n", resp.Fee)
+		if resp.Receipt != nil && resp.Receipt.Payment.ID != "" {
+			fmt.Fprintf(w, "Paid by %s, transaction %s\n", resp.Receipt.Payment.Method, resp.Receipt.Payment.ID)
+		}
+	})
+	return nil
+}
+
+func (c *cli) find(args []string) error {
+	pos, err := parse(c.flags("find"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	lotName, slot, err := c.state.manager.FindCar(pos[0])
+	if err != nil {
+		return err
+	}
+	c.print(carLocation{Lot: lotName, Slot: *slot}, func(w io.Writer) {
+		fmt.Fprintf(w, "%s is in %s at %s\n", pos[0], lotName, slot.Location())
+	})
+	return nil
+}
+
+func (c *cli) search(args []string) error {
+	fs := c.flags("search")
+	params := map[string]*string{
+		"color":    fs.String("color", "", "car color"),
+		"make":     fs.String("make", "", "car make"),
+		"size":     fs.String("size", "", "vehicle size"),
+		"handicap": fs.String("handicap", "", "true or false"),
+		"within":   fs.String("within", "", "parked within this duration, e.g. 30m"),
+	}
+	if _, err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	cars, err := c.state.manager.search(func(name string) string { return *params[name] })
+	if err != nil {
+		return err
+	}
+	c.print(cars, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PLATE\tCOLOR\tMAKE\tSIZE\tLOT\tLOCATION\tATTENDANT\tPARKED AT")
+		for _, car := range cars {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", car.Number, car.Color, car.Make, car.Size,
+				car.Lot, car.Location(), car.Attendant, car.ParkedAt.Format(time.DateTime))
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+func (c *cli) status(args []string) error {
+	pos, err := parse(c.flags("status"), args, 0, 1)
+	if err != nil {
+		return err
+	}
+	lots := c.state.manager.lots()
+	if len(pos) == 1 {
+		lot, err := c.state.manager.Lot(pos[0])
+		if err != nil {
+			return err
+		}
+		lots = []*ParkingLot{lot}
+	}
+	statuses := []LotStatus{}
+	for _, lot := range lots {
+		statuses = append(statuses, lot.Status())
+	}
+	c.printStatuses(statuses)
+	return nil
+}
+
+func (c *cli) printStatuses(statuses []LotStatus) {
+	c.print(statuses, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "LOT\tCAPACITY\tOCCUPIED\tFREE")
+		for _, s := range statuses {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", s.Name, s.Capacity, s.Occupied, s.Free)
+		}
+		tw.Flush()
+	})
+}
+
+func (c *cli) lots(args []string) error {
+	if len(args) == 0 {
+		return badRequest("lots: expected list or create")
+	}
+	switch args[0] {
+	case "list":
+		return c.status(args[1:])
+	case "create":
+		return c.createLot(args[1:])
+	}
+	return badRequest(fmt.Sprintf("lots: unknown subcommand %q", args[0]))
+}
+
+func (c *cli) createLot(args []string) error {
+	fs := c.flags("lots create")
+	slots := fs.Int("slots", 0, "number of slots")
+	sizes := fs.String("sizes", "", "comma-separated slot sizes, one per slot; overrides -slots")
+	accessible := fs.String("accessible", "", "comma-separated accessible slot numbers")
+	busSpan := fs.Int("bus-span", 0, "adjacent large slots a bus may take")
+	pos, err := parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	var lot *ParkingLot
+	if *sizes != "" {
+		var slotSizes []VehicleSize
+		for _, s := range strings.Split(*sizes, ",") {
+			size, err := ParseVehicleSize(s)
+			if err != nil {
+				return badRequest(err.Error())
+			}
+			slotSizes = append(slotSizes, size)
+		}
+		lot = NewParkingLotWithSizes(pos[0], slotSizes...)
+	} else if *slots > 0 {
+		lot = NewParkingLot(pos[0], *slots)
+	} else {
+		return badRequest("lots create: -slots or -sizes is required")
+	}
+	lot.BusSpan = *busSpan
+	if *accessible != "" {
+		var numbers []int
+		for _, s := range strings.Split(*accessible, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return badRequest(fmt.Sprintf("accessible slot %q is not a number", s))
+			}
+			numbers = append(numbers, n)
+		}
+		if err := lot.SetAccessible(numbers...); err != nil {
+			return badRequest(err.Error())
+		}
+	}
+	if err := c.state.addLot(lot); err != nil {
+		return err
+	}
+	c.printStatuses([]LotStatus{lot.Status()})
+	return nil
+}
+
+// report summarizes the journal over a range of days per lot and per
+// attendant, or exports one of its tables as CSV.
+func (c *cli) report(args []string) error {
+	fs := c.flags("report")
+	from := fs.String("from", "", "first day to report, YYYY-MM-DD; default today")
+	to := fs.String("to", "", "last day to report, YYYY-MM-DD; default the first day")
+	date := fs.String("date", "", "one day to report, YYYY-MM-DD")
+	table := fs.String("csv", "", "write a table as CSV: lots, attendants or hourly")
+	if _, err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *date != "" {
+		if *from != "" || *to != "" {
+			return badRequest("report: -date cannot be combined with -from or -to")
+		}
+		*from, *to = *date, *date
+	}
+	start, end, err := ParseReportRange(*from, *to, c.state.manager.now())
+	if err != nil {
+		return err
+	}
+	r, err := ReportFile(filepath.Join(c.state.dataDir, "journal.jsonl"), start, end)
+	if err != nil {
+		return err
+	}
+	if *table != "" {
+		return r.WriteCSV(c.stdout, *table)
+	}
+
+	c.print(r, func(w io.Writer) {
+		fmt.Fprintf(w, "Report for %s to %s\n", start.Format(time.DateOnly), end.AddDate(0, 0, -1).Format(time.DateOnly))
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "LOT\tENTRIES\tEXITS\tREVENUE\tAVG STAY\tPEAK")
+		for _, l := range r.Lots {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%.0fm\t%d/%d\n", l.Lot, l.Entries, l.Exits, l.Revenue,
+				l.AverageDwellMinutes, l.PeakOccupancy, l.Capacity)
+		}
+		if len(r.Attendants) > 0 {
+			fmt.Fprintln(tw, "\nLOT\tATTENDANT\tENTRIES\tEXITS\tREVENUE")
+			for _, a := range r.Attendants {
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", a.Lot, a.Attendant, a.Entries, a.Exits, a.Revenue)
+			}
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+func (c *cli) reserve(args []string) error {
+	fs := c.flags("reserve")
+	lotName := fs.String("lot", "", "lot to book in; default is any lot with room")
+	start := fs.String("start", "", "start of the window, YYYY-MM-DDTHH:MM in local time")
+	length := fs.Duration("for", 2*time.Hour, "length of the window")
+	size := fs.String("size", "", "vehicle size")
+	slot := fs.Int("slot", 0, "a particular slot to book")
+	pos, err := parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	from, err := time.ParseInLocation("2006-01-02T15:04", *start, time.Local)
+	if err != nil {
+		return badRequest("-start must look like 2024-03-04T09:00")
+	}
+	req := ReservationRequest{Plate: pos[0], Size: VehicleSize(*size), Slot: *slot, Start: from, End: from.Add(*length)}
+	r, err := c.state.manager.Reserve(*lotName, req)
+	if err != nil {
+		return err
+	}
+	c.print(r, func(w io.Writer) {
+		fmt.Fprintf(w, "Reserved %s in %s from %s to %s. Reservation: %s\n", r.Plate, r.Lot,
+			r.Start.Format("2006-01-02 15:04"), r.End.Format("15:04"), r.ID)
+	})
+	return nil
+}
+
+func (c *cli) reservations(args []string) error {
+	if len(args) > 0 && args[0] == "cancel" {
+		fs := c.flags("reservations cancel")
+		lotName := fs.String("lot", "", "lot the reservation is in")
+		pos, err := parse(fs, args[1:], 1, 1)
+		if err != nil {
+			return err
+		}
+		lot, err := c.state.manager.Lot(*lotName)
+		if err != nil {
+			return err
+		}
+		if err := lot.CancelReservation(pos[0]); err != nil {
+			return err
+		}
+		c.print(map[string]string{"Cancelled": pos[0]}, func(w io.Writer) { fmt.Fprintln(w, "Cancelled", pos[0]) })
+		return nil
+	}
+
+	pos, err := parse(c.flags("reservations"), args, 0, 1)
+	if err != nil {
+		return err
+	}
+	lots := c.state.manager.lots()
+	if len(pos) == 1 {
+		lot, err := c.state.manager.Lot(pos[0])
+		if err != nil {
+			return err
+		}
+		lots = []*ParkingLot{lot}
+	}
+	list := []Reservation{}
+	for _, lot := range lots {
+		list = append(list, lot.Reservations()...)
+	}
+	c.print(list, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tLOT\tPLATE\tSIZE\tSTART\tEND\tSTATUS\tSLOT")
+		for _, r := range list {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", r.ID, r.Lot, r.Plate, r.Size,
+				r.Start.Format("2006-01-02 15:04"), r.End.Format("15:04"), r.Status, r.HeldSlot)
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+func (c *cli) passes(args []string) error {
+	switch {
+	case len(args) > 0 && args[0] == "add":
+		return c.addPass(args[1:])
+	case len(args) > 0 && args[0] == "remove":
+		pos, err := parse(c.flags("passes remove"), args[1:], 1, 1)
+		if err != nil {
+			return err
+		}
+		if err := c.state.manager.RemovePass(pos[0]); err != nil {
+			return err
+		}
+		c.print(map[string]string{"Removed": pos[0]}, func(w io.Writer) { fmt.Fprintln(w, "Removed the pass of", pos[0]) })
+		return nil
+	case len(args) > 0 && args[0] == "list":
+		args = args[1:]
+	}
+
+	if _, err := parse(c.flags("passes"), args, 0, 0); err != nil {
+		return err
+	}
+	list := c.state.manager.ListPasses()
+	c.print(list, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tPLATE\tHOLDER\tFROM\tUNTIL\tLOTS\tSLOT\tDISCOUNT")
+		for _, p := range list {
+			lots := "all"
+			if len(p.Lots) > 0 {
+				lots = strings.Join(p.Lots, ",")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d%%\n", p.ID, p.Plate, p.Holder,
+				p.From.Format(time.DateOnly), p.Until.Format(time.DateOnly), lots, p.Slot, p.Discount)
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+func (c *cli) addPass(args []string) error {
+	fs := c.flags("passes add")
+	from := fs.String("from", "", "first valid day, YYYY-MM-DD; default today")
+	until := fs.String("until", "", "first day the pass is no longer valid, YYYY-MM-DD")
+	lots := fs.String("lots", "", "comma-separated lots the pass covers; default every lot")
+	slot := fs.Int("slot", 0, "dedicated slot, in the pass's only lot")
+	discount := fs.Int("discount", 100, "percent off the parking fee")
+	holder := fs.String("holder", "", "name of the pass holder")
+	pos, err := parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	p := Pass{Plate: pos[0], Holder: *holder, Slot: *slot, Discount: *discount}
+	if *from == "" {
+		y, m, d := c.state.manager.now().Date()
+		p.From = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	} else if p.From, err = time.ParseInLocation(time.DateOnly, *from, time.Local); err != nil {
+		return badRequest("-from must look like 2024-03-01")
+	}
+	if p.Until, err = time.ParseInLocation(time.DateOnly, *until, time.Local); err != nil {
+		return badRequest("-until must look like 2024-04-01")
+	}
+	if *lots != "" {
+		p.Lots = strings.Split(*lots, ",")
+	}
+	if p, err = c.state.manager.AddPass(p); err != nil {
+		return err
+	}
+	c.print(p, func(w io.Writer) {
+		fmt.Fprintf(w, "Pass %s for %s valid %s to %s, %d%% off\n", p.ID, p.Plate,
+			p.From.Format(time.DateOnly), p.Until.Format(time.DateOnly), p.Discount)
+	})
+	return nil
+}
+
+func (c *cli) receipts(args []string) error {
+	fs := c.flags("receipts")
+	ticketID := fs.String("ticket", "", "ticket of one paid exit")
+	pos, err := parse(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	var list []Receipt
+	switch {
+	case *ticketID != "":
+		r, err := c.state.manager.Receipt(*ticketID)
+		if err != nil {
+			return err
+		}
+		list = []Receipt{r}
+	case len(pos) == 1:
+		if list, err = c.state.manager.ReceiptsFor(pos[0]); err != nil {
+			return err
+		}
+	default:
+		return badRequest("receipts: a plate or -ticket is required")
+	}
+	c.print(list, func(w io.Writer) {
+		for _, r := range list {
+			printReceipt(w, r)
+		}
+	})
+	return nil
+}
+
+func printReceipt(w io.Writer, r Receipt) {
+	fmt.Fprintf(w, "%s  %s  %s  %s to %s\n", r.Ticket.ID, r.Lot, r.Ticket.Plate,
+		r.Quote.Entry.Format("2006-01-02 15:04"), r.Quote.Exit.Format("15:04"))
+	for _, line := range r.Quote.Lines {
+		fmt.Fprintf(w, "  %-30s %s\n", line.Description, line.Amount)
+	}
+	fmt.Fprintf(w, "  %-30s %s\n", "Paid by "+string(r.Payment.Method), r.Payment.Amount)
+	for _, refund := range r.Refunds {
+		desc := "Refund " + refund.Reason
+		if refund.Pending {
+			desc += " (pending)"
+		}
+		fmt.Fprintf(w, "  %-30s %s\n", desc, refund.Amount.Neg())
+	}
+}
+
+func (c *cli) refund(args []string) error {
+	fs := c.flags("refund")
+	amount := fs.String("amount", "", "amount to refund, e.g. 12.50; default is everything not yet refunded")
+	reason := fs.String("reason", "", "why the money is given back")
+	pos, err := parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	var money Money
+	if *amount != "" {
+		if money, err = ParseMoney(*amount, ""); err != nil {
+			return badRequest(err.Error())
+		}
+	}
+	r, err := c.state.manager.RefundTicket(pos[0], money, *reason)
+	if err != nil {
+		return err
+	}
+	c.print(r, func(w io.Writer) { printReceipt(w, r) })
+	return nil
+}
@@ -0,0 +1,157 @@
+// cli_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func runCLITest(t *testing.T, dir string, want int, args ...string) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	if code := runCLI(dir, "", args, &stdout, &stderr); code != want {
+		t.Fatalf("%v: expected exit %d, got %d: %s%s", args, want, code, stdout.String(), stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestCLIParkChargeAndStatusAcrossRuns(t *testing.T) {
+	dir := t.TempDir()
+	runCLITest(t, dir, exitOK, "lots", "create", "Lot A", "-slots", "2")
+	runCLITest(t, dir, exitConflict, "lots", "create", "Lot A", "-slots", "2")
+
+	var parked parkResponse
+	out := runCLITest(t, dir, exitOK, "park", "CL1", "-color", "White", "-json")
+	if err := json.Unmarshal([]byte(out), &parked); err != nil || parked.Lot != "Lot A" || parked.Slot != 1 || parked.Ticket.ID == "" {
+		t.Fatalf("unexpected park output %q (err %v)", out, err)
+	}
+	runCLITest(t, dir, exitConflict, "park", "CL1")
+	runCLITest(t, dir, exitOK, "park", "-lot", "Lot A", "CL2")
+	runCLITest(t, dir, exitConflict, "park", "CL3")
+	runCLITest(t, dir, exitIncompatible, "park", "BUS1", "-size", "bus")
+
+	if out := runCLITest(t, dir, exitOK, "find", "CL1"); !strings.Contains(out, "Lot A at Row A, position 1 (slot 1)") {
+		t.Errorf("unexpected find output %q", out)
+	}
+	var cars []CarWithAttendant
+	out = runCLITest(t, dir, exitOK, "search", "-color", "White", "-json")
+	if err := json.Unmarshal([]byte(out), &cars); err != nil || len(cars) != 1 || cars[0].Number != "CL1" {
+		t.Errorf("unexpected search output %q", out)
+	}
+
+	var charged exitResponse
+	out = runCLITest(t, dir, exitOK, "charge", "-ticket", parked.Ticket.ID, "-json")
+	if err := json.Unmarshal([]byte(out), &charged); err != nil || charged.Ticket.Plate != "CL1" || charged.Fee.Amount <= 0 {
+		t.Errorf("unexpected charge output %q", out)
+	}
+	runCLITest(t, dir, exitConflict, "charge", "-ticket", parked.Ticket.ID)
+	runCLITest(t, dir, exitOK, "unpark", "CL2")
+	runCLITest(t, dir, exitNotFound, "unpark", "CL2")
+
+	var statuses []LotStatus
+	out = runCLITest(t, dir, exitOK, "status", "-json")
+	if err := json.Unmarshal([]byte(out), &statuses); err != nil || len(statuses) != 1 || statuses[0].Free != 2 {
+		t.Errorf("unexpected status output %q", out)
+	}
+
+	var report Report
+	out = runCLITest(t, dir, exitOK, "report", "-json")
+	if err := json.Unmarshal([]byte(out), &report); err != nil || len(report.Lots) != 1 ||
+		report.Lots[0].Entries != 2 || report.Lots[0].Exits != 2 || report.Lots[0].Revenue != charged.Fee {
+		t.Errorf("unexpected report output %q", out)
+	}
+}
+
+func TestCLIUsageErrors(t *testing.T) {
+	dir := t.TempDir()
+	runCLITest(t, dir, exitUsage, "fly")
+	runCLITest(t, dir, exitUsage, "park")
+	runCLITest(t, dir, exitUsage, "park", "X1", "-size", "blimp")
+	runCLITest(t, dir, exitUsage, "lots", "create", "Lot A")
+	runCLITest(t, dir, exitNotFound, "status", "Nope")
+	runCLITest(t, dir, exitOK, "help")
+}
+
+func TestCLIConcurrentRunsTakeTurns(t *testing.T) {
+	dir := t.TempDir()
+	runCLITest(t, dir, exitOK, "lots", "create", "Lot A", "-slots", "8")
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var stdout, stderr bytes.Buffer
+			if code := runCLI(dir, "", []string{"park", fmt.Sprintf("CC%d", i)}, &stdout, &stderr); code != exitOK {
+				t.Errorf("park CC%d: exit %d: %s", i, code, stderr.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	out := runCLITest(t, dir, exitOK, "status", "-json")
+	var status []LotStatus
+	if err := json.Unmarshal([]byte(out), &status); err != nil || len(status) != 1 || status[0].Occupied != 8 {
+		t.Fatalf("expected all eight cars saved, got %q (err %v)", out, err)
+	}
+	f, err := os.Open(filepath.Join(dir, "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := ReadJournal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[uint64]bool)
+	for _, e := range entries {
+		if seen[e.Seq] {
+			t.Fatalf("sequence number %d journaled twice", e.Seq)
+		}
+		seen[e.Seq] = true
+	}
+}
+
+func TestCLIRecoversFromTornJournal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.jsonl")
+	runCLITest(t, dir, exitOK, "lots", "create", "Lot A", "-slots", "2")
+	runCLITest(t, dir, exitOK, "park", "TJ1")
+	runCLITest(t, dir, exitOK, "park", "TJ2")
+
+	// A crash mid-write leaves half a line at the end.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"Seq":9,"Change":9,"Time":"2024-03-04T`)
+	f.Close()
+
+	runCLITest(t, dir, exitOK, "status")
+	runCLITest(t, dir, exitOK, "unpark", "TJ1")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadJournal(bytes.NewReader(data))
+	if err != nil || !bytes.HasSuffix(data, []byte("\n")) || entries[len(entries)-1].Kind != JournalUnparked {
+		t.Fatalf("expected the torn line cut and the unpark journaled after it, got %d entries (err %v)", len(entries), err)
+	}
+
+	// A journal damaged past repair still lets read-only commands run.
+	if err := os.WriteFile(path, append([]byte("not json\n"), data...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out := runCLITest(t, dir, exitOK, "find", "TJ2"); !strings.Contains(out, "slot 2") {
+		t.Errorf("unexpected find output %q", out)
+	}
+	runCLITest(t, dir, exitOK, "status")
+	runCLITest(t, dir, exitOK, "lots", "list")
+	runCLITest(t, dir, exitError, "park", "TJ3")
+}
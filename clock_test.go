@@ -0,0 +1,46 @@
+// clock_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockDrivesParkedAtAndFee(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	lot := NewParkingLot("Lot A", 1)
+	lot.SetClock(clock)
+
+	car := &Car{Number: "KA01CL0001"}
+	_, _ = lot.ParkCar(car)
+	if !car.ParkedAt.Equal(start) {
+		t.Fatalf("expected ParkedAt %v, got %v", start, car.ParkedAt)
+	}
+
+	clock.Advance(42 * time.Minute)
+	_, fee, err := lot.UnparkCarAndCharge("KA01CL0001")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fee != 84 {
+		t.Errorf("expected ₹84 for 42 minutes, got ₹%d", fee)
+	}
+}
+
+func TestManagerClockAppliesToDurationQueries(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC))
+	lot := NewParkingLot("Lot A", 2)
+	manager := &ParkingManager{Lots: []*ParkingLot{lot}}
+	manager.SetClock(clock)
+
+	_, _ = lot.ParkCar(&Car{Number: "EARLY"})
+	clock.Advance(45 * time.Minute)
+	_, _ = lot.ParkCar(&Car{Number: "LATE"})
+	clock.Advance(10 * time.Minute)
+
+	found := manager.FindCarsParkedWithin(30 * time.Minute)
+	if len(found) != 1 || found[0].Number != "LATE" {
+		t.Errorf("expected only LATE within 30 minutes, got %+v", found)
+	}
+}
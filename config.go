@@ -0,0 +1,359 @@
+// config.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Config describes the lots of a site. It is read from JSON, e.g.
+//
+//	{"Lots": [{"Name": "Lot A",
+//	           "Floors": [{"Name": "G", "Rows": [{"Name": "A", "Slots": 10, "Size": "compact"}]}],
+//	           "Accessible": [1, 2],
+//	           "Tariff": {"Grace": "15m", "Slabs": {"": [{"Hours": 1, "PerHour": 40}]}},
+//	           "Attendants": ["Ravi"]}]}
+type Config struct {
+	Lots []LotConfig
+}
+
+type LotConfig struct {
+	Name       string
+	Slots      int // a plain lot with rows A–E round-robin; used when Floors is empty
+	Floors     []FloorConfig
+	Accessible []int          // slot numbers reserved for handicap drivers; no others are
+	Overflow   float64        // release accessible slots above this occupied fraction; 0 never does
+	BusSpan    int            // adjacent large slots a bus may take; 0 disables, as on the lot
+	Tariff     *TariffConfig  // nil keeps DefaultTariff
+	Pricing    *PricingConfig // nil quotes in DefaultCurrency, untaxed, to the paisa
+	Attendants []string
+
+	ReservationGrace string // how late a reserved plate may arrive, e.g. "20m"
+}
+
+type FloorConfig struct {
+	Name string
+	Rows []RowConfig
+}
+
+// RowConfig is a row of Slots slots of one size, numbered on from the
+// previous row of the lot. Row names need only be unique within a floor.
+type RowConfig struct {
+	Name  string
+	Slots int
+	Size  VehicleSize
+}
+
+// PricingConfig is what the lot charges on top of its tariff.
+type PricingConfig struct {
+	Currency string
+	Taxes    []TaxConfig
+	RoundTo  string // round totals to a multiple of this amount, e.g. "1" for whole rupees
+	Rounding string // half_up (the default), up or down
+}
+
+type TaxConfig struct {
+	Name    string
+	Percent float64 // e.g. 9 for CGST at 9%
+}
+
+// TariffConfig builds a RuleTariff when Slabs is set and a PerMinuteTariff
+// otherwise.
+type TariffConfig struct {
+	PerMinute      int
+	MinimumMinutes int
+	ProRata        bool   // bill per-minute stays by the second
+	Grace          string // a duration such as "15m"
+	Slabs          map[VehicleSize][]HourlySlab
+	DailyCap       int
+	NightRate      int
+	NightStart     int
+	NightEnd       int
+	WeekendPercent int
+	LostTicket     int
+
+	ReservationCharge int
+	NoShowCharge      int
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (cfg *Config) validate() error {
+	seen := make(map[string]bool)
+	for _, lc := range cfg.Lots {
+		if lc.Name == "" {
+			return fmt.Errorf("%w: every lot needs a Name", ErrInvalidConfig)
+		}
+		if seen[lc.Name] {
+			return fmt.Errorf("%w: lot %q is defined twice", ErrInvalidConfig, lc.Name)
+		}
+		seen[lc.Name] = true
+		if _, err := lc.NewLot(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lc LotConfig) invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: lot %q: %s", ErrInvalidConfig, lc.Name, fmt.Sprintf(format, args...))
+}
+
+// NewLot builds the empty lot the config describes, with its tariff,
+// accessible slots and overflow rule applied.
+func (lc LotConfig) NewLot() (*ParkingLot, error) {
+	var lot *ParkingLot
+	switch {
+	case len(lc.Floors) > 0 && lc.Slots > 0:
+		return nil, lc.invalid("set Slots or Floors, not both")
+	case len(lc.Floors) > 0:
+		layout, err := lc.layout()
+		if err != nil {
+			return nil, err
+		}
+		if lot, err = NewParkingLotWithLayout(lc.Name, layout); err != nil {
+			return nil, lc.invalid("%v", err)
+		}
+	case lc.Slots > 0:
+		lot = NewParkingLot(lc.Name, lc.Slots)
+	default:
+		return nil, lc.invalid("Slots or Floors is required")
+	}
+	if err := lc.apply(lot); err != nil {
+		return nil, err
+	}
+	return lot, nil
+}
+
+// layout numbers the configured rows on from one another, floor by floor.
+func (lc LotConfig) layout() (Layout, error) {
+	var layout Layout
+	next := 1
+	for _, floor := range lc.Floors {
+		fl := FloorLayout{Name: floor.Name}
+		for _, row := range floor.Rows {
+			if row.Slots <= 0 {
+				return Layout{}, lc.invalid("floor %q: row %q needs Slots", floor.Name, row.Name)
+			}
+			size := row.Size
+			if size != "" {
+				parsed, err := ParseVehicleSize(string(size))
+				if err != nil {
+					return Layout{}, lc.invalid("row %q: %v", row.Name, err)
+				}
+				size = parsed
+			}
+			fl.Rows = append(fl.Rows, RowLayout{Name: row.Name, First: next, Last: next + row.Slots - 1, Size: size})
+			next += row.Slots
+		}
+		layout.Floors = append(layout.Floors, fl)
+	}
+	return layout, nil
+}
+
+// apply sets what the config decides about a lot beyond its slots: the
+// tariff and pricing, the accessible slots, the bus span and the overflow
+// rule.
+func (lc LotConfig) apply(lot *ParkingLot) error {
+	if lc.Tariff != nil {
+		tariff, err := lc.Tariff.Tariff()
+		if err != nil {
+			return lc.invalid("%v", err)
+		}
+		lot.SetTariff(tariff)
+	}
+	if lc.Pricing != nil {
+		pricing, err := lc.Pricing.Pricing()
+		if err != nil {
+			return lc.invalid("%v", err)
+		}
+		lot.SetPricing(pricing)
+	}
+	// The config lists every accessible slot, so none clears them.
+	if err := lot.SetAccessible(lc.Accessible...); err != nil {
+		return lc.invalid("%v", err)
+	}
+	if lc.BusSpan < 0 {
+		return lc.invalid("BusSpan must not be negative")
+	}
+	if err := lot.SetBusSpan(lc.BusSpan); err != nil {
+		return err
+	}
+	if lc.Overflow > 0 {
+		lot.SetAccessibleOverflow(OverflowAbove(lc.Overflow))
+	}
+	if lc.ReservationGrace != "" {
+		grace, err := time.ParseDuration(lc.ReservationGrace)
+		if err != nil {
+			return lc.invalid("ReservationGrace: %v", err)
+		}
+		lot.mu.Lock()
+		lot.ReservationGrace = grace
+		lot.mu.Unlock()
+	}
+	return nil
+}
+
+func (pc PricingConfig) Pricing() (Pricing, error) {
+	p := Pricing{Currency: strings.ToUpper(pc.Currency)}
+	for _, tax := range pc.Taxes {
+		if tax.Name == "" || tax.Percent <= 0 || tax.Percent > 100 {
+			return Pricing{}, fmt.Errorf("tax %q: Name and a Percent of 0-100 are required", tax.Name)
+		}
+		p.Taxes = append(p.Taxes, TaxRate{Name: tax.Name, BasisPoints: int(math.Round(tax.Percent * 100))})
+	}
+	mode, err := ParseRoundingMode(pc.Rounding)
+	if err != nil {
+		return Pricing{}, err
+	}
+	p.Rounding.Mode = mode
+	if pc.RoundTo != "" {
+		unit, err := ParseMoney(pc.RoundTo, p.Currency)
+		if err != nil || unit.Amount == 0 {
+			return Pricing{}, fmt.Errorf("RoundTo %q: want an amount such as 1 or 0.50", pc.RoundTo)
+		}
+		p.Rounding.Unit = unit.Amount
+	}
+	return p, nil
+}
+
+func (tc TariffConfig) Tariff() (Tariff, error) {
+	if len(tc.Slabs) == 0 {
+		if tc.PerMinute <= 0 {
+			return nil, errors.New("tariff needs PerMinute or Slabs")
+		}
+		return PerMinuteTariff{
+			RatePerMinute:     tc.PerMinute,
+			MinimumMinutes:    tc.MinimumMinutes,
+			ProRata:           tc.ProRata,
+			LostTicket:        tc.LostTicket,
+			ReservationCharge: tc.ReservationCharge,
+			NoShowCharge:      tc.NoShowCharge,
+		}, nil
+	}
+	var grace time.Duration
+	if tc.Grace != "" {
+		var err error
+		if grace, err = time.ParseDuration(tc.Grace); err != nil {
+			return nil, fmt.Errorf("tariff Grace: %v", err)
+		}
+	}
+	slabs := make(map[VehicleSize][]HourlySlab, len(tc.Slabs))
+	for size, list := range tc.Slabs {
+		class := VehicleSize("")
+		if size != "" {
+			parsed, err := ParseVehicleSize(string(size))
+			if err != nil {
+				return nil, fmt.Errorf("tariff Slabs: %v", err)
+			}
+			class = parsed
+		}
+		slabs[class] = list
+	}
+	tariff := RuleTariff{
+		Grace:          grace,
+		Slabs:          slabs,
+		DailyCap:       tc.DailyCap,
+		NightRate:      tc.NightRate,
+		NightStart:     tc.NightStart,
+		NightEnd:       tc.NightEnd,
+		WeekendPercent: tc.WeekendPercent,
+		LostTicket:     tc.LostTicket,
+
+		ReservationCharge: tc.ReservationCharge,
+		NoShowCharge:      tc.NoShowCharge,
+	}
+	if err := tariff.Validate(); err != nil {
+		return nil, err
+	}
+	return tariff, nil
+}
+
+// applyConfig builds the configured lots that are not in the store yet and
+// applies the config to the ones that are. A stored lot whose slot count
+// no longer matches the config is an error rather than being rebuilt, as
+// it may hold parked cars.
+func (s *state) applyConfig(cfg *Config) error {
+	s.attendants = make(map[string][]*Attendant)
+	for _, lc := range cfg.Lots {
+		fresh, err := lc.NewLot()
+		if err != nil {
+			return err
+		}
+		lot, err := s.manager.Lot(lc.Name)
+		if err == nil {
+			if err := lc.matchLayout(lot, fresh); err != nil {
+				return err
+			}
+			if err := lc.apply(lot); err != nil {
+				return err
+			}
+		} else {
+			lot = fresh
+			if err := s.addLot(lot); err != nil {
+				return err
+			}
+		}
+		for _, name := range lc.Attendants {
+			s.attendants[lot.Name] = append(s.attendants[lot.Name], &Attendant{Name: name, Lot: lot})
+		}
+	}
+	return nil
+}
+
+// matchLayout refuses a config whose slots differ from the saved lot's:
+// the parked cars and tickets refer to the saved slots.
+func (lc LotConfig) matchLayout(saved, fresh *ParkingLot) error {
+	saved.mu.RLock()
+	defer saved.mu.RUnlock()
+	if len(saved.Slots) != len(fresh.Slots) {
+		return lc.invalid("the saved lot has %d slots but the config describes %d", len(saved.Slots), len(fresh.Slots))
+	}
+	for i, s := range saved.Slots {
+		f := fresh.Slots[i]
+		if s.Number != f.Number || s.Floor != f.Floor || s.Row != f.Row || s.Size != f.Size {
+			return lc.invalid("saved slot %d (floor %q, row %q, size %q) differs from the config's slot %d (floor %q, row %q, size %q)",
+				s.Number, s.Floor, s.Row, s.Size, f.Number, f.Floor, f.Row, f.Size)
+		}
+	}
+	return nil
+}
+
+// attendant returns the configured attendant of the lot with the given
+// name. Lots without configured attendants accept any name, and no name
+// means the driver parked at the gate.
+func (s *state) attendant(lot *ParkingLot, name string) (*Attendant, error) {
+	configured := s.attendants[lot.Name]
+	if name == "" || len(configured) == 0 {
+		return &Attendant{Name: name, Lot: lot}, nil
+	}
+	i := slices.IndexFunc(configured, func(a *Attendant) bool { return a.Name == name })
+	if i < 0 {
+		return nil, badRequest(fmt.Sprintf("%s has no attendant %q", lot.Name, name))
+	}
+	return configured[i], nil
+}
@@ -0,0 +1,176 @@
+// config_test.go
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lots.json")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExampleConfigBuildsLots(t *testing.T) {
+	cfg, err := LoadConfig("config.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lot, err := cfg.Lots[0].NewLot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lot.Slots) != 24 || lot.BusSpan != 3 {
+		t.Fatalf("expected 24 slots and bus span 3, got %d and %d", len(lot.Slots), lot.BusSpan)
+	}
+	if s := lot.Slots[6]; s.Number != 7 || s.Floor != "Ground" || s.Row != "B" || s.Position != 1 || s.Size != SizeRegular || !s.Accessible {
+		t.Errorf("unexpected slot 7 %+v", s)
+	}
+	if s := lot.Slots[23]; s.Row != "M" || s.Size != SizeMotorcycle {
+		t.Errorf("unexpected slot 24 %+v", s)
+	}
+
+	// 09:00–12:00 on a Monday: 3 hours after a 15 minute grace.
+	entry := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	quote := lot.Tariff.Quote(Car{Number: "C1"}, entry, entry.Add(3*time.Hour))
+	if quote.Total != Rupees(40+40+30) {
+		t.Errorf("expected 110 from the configured slabs, got %+v", quote)
+	}
+	if p := lot.Pricing; len(p.Taxes) != 2 || p.Taxes[0].BasisPoints != 900 || p.Rounding.Unit != 100 {
+		t.Errorf("expected CGST and SGST at 9%% rounded to the rupee, got %+v", p)
+	}
+}
+
+func TestConfigRejectsBadLots(t *testing.T) {
+	for name, body := range map[string]string{
+		"unknown field":     `{"Lots": [{"Name": "A", "Slots": 2, "Capacity": 2}]}`,
+		"no slots":          `{"Lots": [{"Name": "A"}]}`,
+		"duplicate lot":     `{"Lots": [{"Name": "A", "Slots": 1}, {"Name": "A", "Slots": 1}]}`,
+		"bad size":          `{"Lots": [{"Name": "A", "Floors": [{"Rows": [{"Name": "R", "Slots": 1, "Size": "blimp"}]}]}]}`,
+		"bad accessible":    `{"Lots": [{"Name": "A", "Slots": 2, "Accessible": [9]}]}`,
+		"tariff no rates":   `{"Lots": [{"Name": "A", "Slots": 2, "Tariff": {}}]}`,
+		"bad tax":           `{"Lots": [{"Name": "A", "Slots": 2, "Pricing": {"Taxes": [{"Name": "GST", "Percent": -1}]}}]}`,
+		"bad rounding":      `{"Lots": [{"Name": "A", "Slots": 2, "Pricing": {"Rounding": "sideways"}}]}`,
+		"slabs no fallback": `{"Lots": [{"Name": "A", "Slots": 2, "Tariff": {"Slabs": {"large": [{"PerHour": 80}]}}}]}`,
+		"empty slabs":       `{"Lots": [{"Name": "A", "Slots": 2, "Tariff": {"Slabs": {"": []}}}]}`,
+		"free slab":         `{"Lots": [{"Name": "A", "Slots": 2, "Tariff": {"Slabs": {"": [{"Hours": 1, "PerHour": 0}]}}}]}`,
+		"negative hours":    `{"Lots": [{"Name": "A", "Slots": 2, "Tariff": {"Slabs": {"": [{"Hours": -1, "PerHour": 40}]}}}]}`,
+		"night hour":        `{"Lots": [{"Name": "A", "Slots": 2, "Tariff": {"Slabs": {"": [{"PerHour": 40}]}, "NightRate": 10, "NightStart": 22, "NightEnd": 24}}]}`,
+	} {
+		if _, err := LoadConfig(writeConfig(t, body)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+}
+
+func TestConfigKeepsSavedLotState(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, `{"Lots": [{"Name": "Lot A", "Slots": 3, "Attendants": ["Ravi"],
+		"Tariff": {"PerMinute": 5, "MinimumMinutes": 1}}]}`)
+
+	st, err := openState(dir, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := st.attendant(st.manager.Lots[0], "Ravi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ParkCarForDriver(&Car{Number: "CF1"}); err != nil {
+		t.Fatal(err)
+	}
+	st.close()
+
+	st, err = openState(dir, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lot := st.manager.Lots[0]
+	if slot, err := lot.FindCar("CF1"); err != nil || slot.AttendantName != "Ravi" {
+		t.Fatalf("expected CF1 to survive the restart, got %+v (err %v)", slot, err)
+	}
+	if quote, _ := lot.QuoteFee("CF1"); quote.Total != Rupees(5) {
+		t.Errorf("expected the configured tariff after restart, got %+v", quote)
+	}
+	if _, err := st.attendant(lot, "Bob"); err == nil {
+		t.Error("expected an unconfigured attendant to be refused")
+	}
+	st.close()
+
+	grown := writeConfig(t, `{"Lots": [{"Name": "Lot A", "Slots": 4}]}`)
+	if _, err := openState(dir, grown); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected a slot count mismatch to be refused, got %v", err)
+	}
+}
+
+func TestConfigMustMatchSavedLayout(t *testing.T) {
+	dir := t.TempDir()
+	st, err := openState(dir, writeConfig(t, `{"Lots": [{"Name": "Lot A", "Floors": [{"Name": "G", "Rows": [
+		{"Name": "A", "Slots": 2, "Size": "regular"}, {"Name": "B", "Slots": 1, "Size": "large"}]}], "Accessible": [1]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.close()
+
+	for name, body := range map[string]string{
+		"size": `{"Lots": [{"Name": "Lot A", "Floors": [{"Name": "G", "Rows": [
+			{"Name": "A", "Slots": 2, "Size": "regular"}, {"Name": "B", "Slots": 1, "Size": "compact"}]}]}]}`,
+		"row": `{"Lots": [{"Name": "Lot A", "Floors": [{"Name": "G", "Rows": [
+			{"Name": "A", "Slots": 1, "Size": "regular"}, {"Name": "B", "Slots": 2, "Size": "large"}]}]}]}`,
+		"floor": `{"Lots": [{"Name": "Lot A", "Floors": [{"Name": "L1", "Rows": [
+			{"Name": "A", "Slots": 2, "Size": "regular"}, {"Name": "B", "Slots": 1, "Size": "large"}]}]}]}`,
+	} {
+		if _, err := openState(dir, writeConfig(t, body)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected a changed layout to be refused, got %v", name, err)
+		}
+	}
+
+	// Leaving Accessible out clears the flag the first config set.
+	st, err = openState(dir, writeConfig(t, `{"Lots": [{"Name": "Lot A", "Floors": [{"Name": "G", "Rows": [
+		{"Name": "A", "Slots": 2, "Size": "regular"}, {"Name": "B", "Slots": 1, "Size": "large"}]}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.close()
+	if st.manager.Lots[0].Slots[0].Accessible {
+		t.Error("expected slot 1 no longer accessible")
+	}
+}
+
+func TestConfigBusSpanEditApplies(t *testing.T) {
+	dir := t.TempDir()
+	layout := `"Floors": [{"Name": "G", "Rows": [{"Name": "A", "Slots": 2, "Size": "large"}]}]`
+	st, err := openState(dir, writeConfig(t, `{"Lots": [{"Name": "Depot", `+layout+`}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.manager.Lots[0].ParkCar(&Car{Number: "BUS1", Size: SizeBus}); err == nil {
+		t.Fatal("expected the bus refused without a bus span")
+	}
+	st.close()
+
+	st, err = openState(dir, writeConfig(t, `{"Lots": [{"Name": "Depot", "BusSpan": 2, `+layout+`}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := st.manager.Lots[0].ParkCar(&Car{Number: "BUS1", Size: SizeBus}); err != nil || slot != 1 {
+		t.Fatalf("expected the edited bus span to take slots 1-2, got %d (err %v)", slot, err)
+	}
+	st.close()
+
+	st, err = openState(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.close()
+	if span := st.manager.Lots[0].BusSpan; span != 2 {
+		t.Errorf("expected the bus span saved with the lot, got %d", span)
+	}
+}
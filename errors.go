@@ -0,0 +1,47 @@
+// errors.go
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrLotFull             = errors.New("lot is full")
+	ErrAllLotsFull         = fmt.Errorf("all lots are full: %w", ErrLotFull)
+	ErrCarNotFound         = errors.New("car not found")
+	ErrIncompatibleVehicle = errors.New("incompatible vehicle")
+	ErrAccessibleOnly      = errors.New("only accessible slots are free")
+	ErrNoSlotOffered       = errors.New("allocator offered no slot")
+	ErrDuplicatePlate      = errors.New("plate already parked")
+	ErrUnknownSlot         = errors.New("unknown slot")
+	ErrUnknownLot          = errors.New("unknown lot")
+	ErrLotExists           = errors.New("lot already exists")
+)
+
+// LotError carries the lot and plate an operation failed for. Match the
+// cause with errors.Is against the sentinel errors above.
+type LotError struct {
+	Lot   string
+	Plate string
+	Err   error
+}
+
+func (e *LotError) Error() string {
+	msg := e.Err.Error()
+	if e.Plate != "" {
+		msg = fmt.Sprintf("car %s: %s", e.Plate, msg)
+	}
+	if e.Lot != "" {
+		msg = fmt.Sprintf("%s: %s", e.Lot, msg)
+	}
+	return msg
+}
+
+func (e *LotError) Unwrap() error { return e.Err }
+
+func (pl *ParkingLot) errorf(plate string, err error) error {
+	return &LotError{Lot: pl.Name, Plate: plate, Err: err}
+}
+
+func (e *DuplicatePlateError) Is(target error) bool { return target == ErrDuplicatePlate }
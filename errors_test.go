@@ -0,0 +1,55 @@
+// errors_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSentinelErrorsFromParkPaths(t *testing.T) {
+	lot := NewParkingLot("Lot A", 1)
+	_, _ = lot.ParkCar(&Car{Number: "E1"})
+
+	_, err := lot.ParkCar(&Car{Number: "E2"})
+	if !errors.Is(err, ErrLotFull) {
+		t.Errorf("ParkCar: expected ErrLotFull, got %v", err)
+	}
+	var lotErr *LotError
+	if !errors.As(err, &lotErr) || lotErr.Lot != "Lot A" || lotErr.Plate != "E2" {
+		t.Errorf("expected LotError naming Lot A and E2, got %#v", err)
+	}
+
+	if _, err := lot.ParkCarWithAttendant(&Car{Number: "E3"}, "Ravi"); !errors.Is(err, ErrLotFull) {
+		t.Errorf("ParkCarWithAttendant: expected ErrLotFull, got %v", err)
+	}
+	if _, err := lot.UnparkCar("NOPE"); !errors.Is(err, ErrCarNotFound) {
+		t.Errorf("UnparkCar: expected ErrCarNotFound, got %v", err)
+	}
+	if _, err := lot.FindCar("NOPE"); !errors.Is(err, ErrCarNotFound) {
+		t.Errorf("FindCar: expected ErrCarNotFound, got %v", err)
+	}
+	if _, err := lot.ParkCar(&Car{Number: "E1"}); !errors.Is(err, ErrDuplicatePlate) {
+		t.Errorf("expected ErrDuplicatePlate, got %v", err)
+	}
+}
+
+func TestSentinelErrorsFromManager(t *testing.T) {
+	manager := NewParkingManager(NewParkingLotWithSizes("Lot A", SizeCompact))
+	_, _, _ = manager.ParkEvenly(&Car{Number: "M1", Size: SizeCompact})
+
+	_, _, err := manager.ParkEvenly(&Car{Number: "M2", Size: SizeCompact})
+	if !errors.Is(err, ErrAllLotsFull) || !errors.Is(err, ErrLotFull) {
+		t.Errorf("ParkEvenly: expected ErrAllLotsFull wrapping ErrLotFull, got %v", err)
+	}
+	if _, _, err := manager.ParkEvenly(&Car{Number: "M4"}); !errors.Is(err, ErrIncompatibleVehicle) || errors.Is(err, ErrLotFull) {
+		t.Errorf("ParkEvenly: expected ErrIncompatibleVehicle when no lot has a slot that fits, got %v", err)
+	}
+	if _, _, err := manager.ParkLargeVehicle(&Car{Number: "M3", Size: SizeCompact}); !errors.Is(err, ErrIncompatibleVehicle) {
+		t.Errorf("ParkLargeVehicle: expected ErrIncompatibleVehicle, got %v", err)
+	}
+
+	lot := NewParkingLotWithSizes("Lot B", SizeCompact)
+	if _, err := lot.ParkCar(&Car{Number: "T1", Size: SizeLarge}); !errors.Is(err, ErrIncompatibleVehicle) {
+		t.Errorf("expected ErrIncompatibleVehicle for a truck in a compact slot, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+// events.go
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type EventKind string
+
+const (
+	EventParked        EventKind = "parked"
+	EventUnparked      EventKind = "unparked"
+	EventCharged       EventKind = "charged"
+	EventFull          EventKind = "full"
+	EventAvailable     EventKind = "available"
+	EventParkRejected  EventKind = "park_rejected"
+	EventReserved      EventKind = "reserved"
+	EventNoShow        EventKind = "no_show"
+	EventPaymentFailed EventKind = "payment_failed"
+	EventRefunded      EventKind = "refunded"
+)
+
+// Event describes one change in a lot. Occupied and Capacity are the
+// lot's counts right after the change; Fee is set on charged, failed
+// payment and refunded events, and Reason on rejected parks and failed
+// payments.
+type Event struct {
+	Kind      EventKind
+	Lot       string
+	Slot      int
+	Floor     string `json:",omitempty"`
+	Row       string
+	Plate     string
+	Ticket    string
+	Attendant string
+	Time      time.Time
+	Occupied  int
+	Capacity  int
+	Fee       Money
+	Reason    string
+
+	Reservation string `json:",omitempty"` // on reserved and no_show events
+	Pass        string `json:",omitempty"` // on slot events for a pass holder's car
+}
+
+type EventObserver interface {
+	OnEvent(Event)
+}
+
+type EventObserverFunc func(Event)
+
+func (f EventObserverFunc) OnEvent(e Event) { f(e) }
+
+// AddEventObserver registers an observer. Like the string Observers it is
+// called in event order from the lot's own observer goroutine, so a slow
+// observer never holds up a gate.
+func (pl *ParkingLot) AddEventObserver(observer EventObserver) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.EventObservers = append(pl.EventObservers, observer)
+}
+
+// update runs fn under the write lock and hands the events it queued to
+// the subscribers once the lock is released, so observers may call back
+// into the lot. Each update takes a turn under the lock and delivers in
+// turn, so subscribers see events in the order the changes were made.
+// Every state change in the lot goes through update, so observers see the
+// same events whichever entry point a gate or attendant used.
+func (pl *ParkingLot) update(fn func()) {
+	pl.mu.Lock()
+	fn()
+	events := pl.pending
+	pl.pending = nil
+	if len(events) == 0 {
+		pl.mu.Unlock()
+		return
+	}
+	if pl.observers == nil && (len(pl.Observers) > 0 || len(pl.EventObservers) > 0) {
+		pl.observers = pl.subscribeLocked(lotObservers{pl}, SubscribeOptions{Buffer: observerBuffer, Policy: OverflowBlock})
+	}
+	subs := append([]*Subscription(nil), pl.subs...)
+	turn := pl.nextTurn
+	pl.nextTurn++
+	pl.mu.Unlock()
+
+	pl.turns.wait(turn)
+	defer pl.turns.done()
+	for _, e := range events {
+		for _, s := range subs {
+			s.send(e)
+		}
+	}
+}
+
+// eventTurns lets updates deliver one at a time, in the order of their
+// turns.
+type eventTurns struct {
+	mu   sync.Mutex
+	cond sync.Cond
+	next uint64
+}
+
+func (t *eventTurns) wait(turn uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cond.L == nil {
+		t.cond.L = &t.mu
+	}
+	for t.next != turn {
+		t.cond.Wait()
+	}
+}
+
+func (t *eventTurns) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.next++
+	if t.cond.L != nil {
+		t.cond.Broadcast()
+	}
+}
+
+// observerBuffer is how far the lot's observers may fall behind before
+// gates wait for them.
+const observerBuffer = 1024
+
+// lotObservers calls the lot's Observers and EventObservers for each
+// event from the lot's internal subscription.
+type lotObservers struct{ pl *ParkingLot }
+
+func (o lotObservers) OnEvent(e Event) {
+	pl := o.pl
+	pl.mu.RLock()
+	observers := append([]EventObserver(nil), pl.EventObservers...)
+	legacy := append([]Observer(nil), pl.Observers...)
+	pl.mu.RUnlock()
+
+	for _, observer := range observers {
+		callSafely(pl.Name, func() { observer.OnEvent(e) })
+	}
+	if msg := legacyMessage(e.Kind); msg != "" {
+		for _, observer := range legacy {
+			callSafely(pl.Name, func() { observer(msg) })
+		}
+	}
+}
+
+// legacyMessage maps the state-transition events onto the strings the
+// original func(msg string) observers understand.
+func legacyMessage(kind EventKind) string {
+	switch kind {
+	case EventFull:
+		return "FULL"
+	case EventAvailable:
+		return "AVAILABLE"
+	}
+	return ""
+}
+
+// queueLocked stamps the event with the lot's name, time and occupancy
+// and holds it for delivery when update releases the lock.
+func (pl *ParkingLot) queueLocked(e Event) {
+	e.Lot = pl.Name
+	e.Time = pl.now()
+	e.Capacity = len(pl.Slots)
+	e.Occupied = e.Capacity - pl.indexLocked().total
+	pl.pending = append(pl.pending, e)
+}
+
+func slotEvent(kind EventKind, slot Slot) Event {
+	e := Event{Kind: kind, Slot: slot.Number, Floor: slot.Floor, Row: slot.Row, Ticket: slot.TicketID, Attendant: slot.AttendantName}
+	if slot.Car != nil {
+		e.Plate = slot.Car.Number
+		e.Pass = slot.Car.Pass
+	}
+	return e
+}
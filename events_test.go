@@ -0,0 +1,131 @@
+// events_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func recordEvents(lot *ParkingLot) *[]Event {
+	var events []Event
+	lot.AddEventObserver(EventObserverFunc(func(e Event) {
+		events = append(events, e)
+	}))
+	return &events
+}
+
+// flushObservers waits until the lot's observers have seen every event so far.
+func (pl *ParkingLot) flushObservers() {
+	pl.mu.RLock()
+	s := pl.observers
+	pl.mu.RUnlock()
+	if s != nil {
+		s.Unsubscribe()
+	}
+}
+
+func eventKinds(events []Event) []EventKind {
+	var kinds []EventKind
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	return kinds
+}
+
+func TestEventsForParkFullChargeAndAvailable(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	lot := NewParkingLot("Lot A", 1)
+	lot.SetClock(clock)
+	events := recordEvents(lot)
+
+	_, _ = lot.ParkCarWithAttendant(&Car{Number: "EV1"}, "Kiran")
+	_, _ = lot.ParkCar(&Car{Number: "EV2"})
+	clock.Advance(5 * time.Minute)
+	_, _, _ = lot.UnparkCarAndCharge("EV1")
+	lot.flushObservers()
+
+	want := []EventKind{EventParked, EventFull, EventParkRejected, EventCharged, EventUnparked, EventAvailable}
+	got := eventKinds(*events)
+	if len(got) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, got)
+		}
+	}
+
+	parked := (*events)[0]
+	if parked.Lot != "Lot A" || parked.Slot != 1 || parked.Row != "A" || parked.Plate != "EV1" ||
+		parked.Attendant != "Kiran" || parked.Occupied != 1 || parked.Capacity != 1 {
+		t.Errorf("unexpected parked event: %+v", parked)
+	}
+	if rejected := (*events)[2]; rejected.Plate != "EV2" || rejected.Reason == "" {
+		t.Errorf("unexpected rejected event: %+v", rejected)
+	}
+	charged := (*events)[3]
+	if charged.Fee != Rupees(10) || !charged.Time.Equal(clock.Now()) {
+		t.Errorf("expected ₹10 charge at %v, got %+v", clock.Now(), charged)
+	}
+	if unparked := (*events)[4]; unparked.Occupied != 0 {
+		t.Errorf("expected occupancy 0 after unpark, got %d", unparked.Occupied)
+	}
+}
+
+func TestStringObserversStillNotified(t *testing.T) {
+	lot := NewParkingLot("Lot A", 1)
+	var messages []string
+	lot.AddObserver(func(msg string) { messages = append(messages, msg) })
+	events := recordEvents(lot)
+
+	_, _ = lot.ParkCarWithNotification(&Car{Number: "S1"})
+	_, _ = lot.ParkCarWithNotification(&Car{Number: "S2"})
+	_, _ = lot.UnparkCarWithNotification("S1")
+	lot.flushObservers()
+
+	if len(messages) != 2 || messages[0] != "FULL" || messages[1] != "AVAILABLE" {
+		t.Errorf("expected FULL then AVAILABLE, got %v", messages)
+	}
+	if len(*events) == 0 {
+		t.Error("expected structured events alongside string notifications")
+	}
+}
+
+func TestEveryEntryPointNotifiesOnTransitionsOnly(t *testing.T) {
+	parkers := map[string]func(lot *ParkingLot, car *Car) (int, error){
+		"ParkCar":                 (*ParkingLot).ParkCar,
+		"ParkCarWithNotification": (*ParkingLot).ParkCarWithNotification,
+		"ParkCarWithAllocator":    func(lot *ParkingLot, car *Car) (int, error) { return lot.ParkCarWithAllocator(car, nil) },
+		"ParkCarWithAttendant":    func(lot *ParkingLot, car *Car) (int, error) { return lot.ParkCarWithAttendant(car, "Sam") },
+		"Attendant.ParkCarForDriver": func(lot *ParkingLot, car *Car) (int, error) {
+			return (&Attendant{Name: "Sam", Lot: lot}).ParkCarForDriver(car)
+		},
+	}
+	unparkers := map[string]func(lot *ParkingLot, plate string) error{
+		"UnparkCar": func(lot *ParkingLot, plate string) error { _, err := lot.UnparkCar(plate); return err },
+		"UnparkCarWithNotification": func(lot *ParkingLot, plate string) error {
+			_, err := lot.UnparkCarWithNotification(plate)
+			return err
+		},
+		"UnparkCarAndCharge": func(lot *ParkingLot, plate string) error { _, _, err := lot.UnparkCarAndCharge(plate); return err },
+	}
+
+	for parkName, park := range parkers {
+		for unparkName, unpark := range unparkers {
+			lot := NewParkingLot("Lot A", 2)
+			var messages []string
+			lot.AddObserver(func(msg string) { messages = append(messages, msg) })
+
+			_, _ = park(lot, &Car{Number: "T1"})
+			_, _ = park(lot, &Car{Number: "T2"})
+			_, _ = park(lot, &Car{Number: "T3"}) // rejected: already full, no new transition
+			_ = unpark(lot, "T1")
+			_ = unpark(lot, "T2") // lot was not full, so no AVAILABLE
+			lot.flushObservers()
+
+			if len(messages) != 2 || messages[0] != "FULL" || messages[1] != "AVAILABLE" {
+				t.Errorf("%s/%s: expected [FULL AVAILABLE], got %v", parkName, unparkName, messages)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// index.go
+package main
+
+import "container/heap"
+
+// slotIndex keeps a plate -> slot map and, per (slot class, accessible)
+// pair, a min-heap of free slot positions, so lookups are a map hit and the
+// default park is a heap pop instead of a scan over every slot.
+//
+// Heaps are cleaned lazily: a slot occupied by a non-default allocator stays
+// in its heap until it reaches the top, and inHeap stops a freed slot from
+// being pushed twice.
+type slotIndex struct {
+	byPlate  map[string]int
+	byTicket map[string]int
+	heaps    [numSizeClasses][2]freeHeap
+	inHeap   []bool
+	free     [numSizeClasses][2]int
+	total    int
+}
+
+type freeHeap []int
+
+func (h freeHeap) Len() int           { return len(h) }
+func (h freeHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h freeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *freeHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *freeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func slotKey(slot Slot) (int, int) {
+	acc := 0
+	if slot.Accessible {
+		acc = 1
+	}
+	return slotClass(slot.Size).rank(), acc
+}
+
+func buildSlotIndex(slots []Slot) *slotIndex {
+	idx := &slotIndex{
+		byPlate:  make(map[string]int),
+		byTicket: make(map[string]int),
+		inHeap:   make([]bool, len(slots)),
+	}
+	for i, slot := range slots {
+		if slot.IsEmpty {
+			if slot.open() {
+				idx.markFree(slots, i)
+			}
+		} else if slot.SpanHead == 0 {
+			idx.byPlate[slot.Car.Number] = i
+			if slot.TicketID != "" {
+				idx.byTicket[slot.TicketID] = i
+			}
+		}
+	}
+	for r := range idx.heaps {
+		for a := range idx.heaps[r] {
+			heap.Init(&idx.heaps[r][a])
+		}
+	}
+	return idx
+}
+
+func (idx *slotIndex) markFree(slots []Slot, i int) {
+	r, a := slotKey(slots[i])
+	idx.free[r][a]++
+	idx.total++
+	if !idx.inHeap[i] {
+		heap.Push(&idx.heaps[r][a], i)
+		idx.inHeap[i] = true
+	}
+}
+
+func (idx *slotIndex) markTaken(slots []Slot, i int) {
+	r, a := slotKey(slots[i])
+	idx.free[r][a]--
+	idx.total--
+}
+
+// first returns the lowest free slot position in the (rank, acc) heap,
+// discarding stale entries on the way.
+func (idx *slotIndex) first(slots []Slot, r, a int) int {
+	h := &idx.heaps[r][a]
+	for h.Len() > 0 {
+		i := (*h)[0]
+		if slots[i].open() {
+			return i
+		}
+		heap.Pop(h)
+		idx.inHeap[i] = false
+	}
+	return -1
+}
+
+// firstFree mirrors the scan in placeLocked for FirstFreeAllocator: the
+// lowest free slot the car fits, accessible slots first for handicap
+// drivers and only when released for everyone else.
+func (idx *slotIndex) firstFree(slots []Slot, car *Car, released bool) int {
+	lowest := func(accessible ...int) int {
+		best := -1
+		for r := car.Size.rank(); r < numSizeClasses; r++ {
+			for _, a := range accessible {
+				if i := idx.first(slots, r, a); i >= 0 && (best < 0 || i < best) {
+					best = i
+				}
+			}
+		}
+		return best
+	}
+	if car.IsHandicap {
+		if i := lowest(1); i >= 0 {
+			return i
+		}
+		return lowest(0)
+	}
+	if released {
+		return lowest(0, 1)
+	}
+	return lowest(0)
+}
+
+// smallestFree returns the lowest free non-accessible slot of the smallest
+// class a vehicle of the given rank fits.
+func (idx *slotIndex) smallestFree(slots []Slot, rank int) int {
+	for r := rank; r < numSizeClasses; r++ {
+		if i := idx.first(slots, r, 0); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// freeFor counts free slots a vehicle of the given rank fits.
+func (idx *slotIndex) freeFor(rank int) int {
+	n := 0
+	for r := rank; r < numSizeClasses; r++ {
+		n += idx.free[r][0] + idx.free[r][1]
+	}
+	return n
+}
+
+// indexLocked returns the lot's index, building it on first use. Building
+// lazily means slots set up by hand right after NewParkingLot are indexed
+// as they are; after that Slots must only change through lot methods.
+func (pl *ParkingLot) indexLocked() *slotIndex {
+	if pl.idx == nil || len(pl.idx.inHeap) != len(pl.Slots) {
+		pl.idx = buildSlotIndex(pl.Slots)
+	}
+	return pl.idx
+}
@@ -0,0 +1,133 @@
+// index_test.go
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// scanFirstFree is the pre-index behavior of ParkCar for an unsized lot.
+func scanFirstFree(lot *ParkingLot) int {
+	for _, slot := range lot.Slots {
+		if slot.IsEmpty {
+			return slot.Number
+		}
+	}
+	return -1
+}
+
+func TestIndexMatchesScanUnderChurn(t *testing.T) {
+	lot := NewParkingLot("Lot A", 200)
+	rnd := rand.New(rand.NewPCG(1, 2))
+	parked := []string{}
+
+	for step := 0; step < 5000; step++ {
+		if len(parked) > 0 && rnd.IntN(3) == 0 {
+			k := rnd.IntN(len(parked))
+			plate := parked[k]
+			parked = append(parked[:k], parked[k+1:]...)
+			if _, err := lot.UnparkCar(plate); err != nil {
+				t.Fatalf("step %d: unpark %s: %v", step, plate, err)
+			}
+			continue
+		}
+
+		want := scanFirstFree(lot)
+		plate := fmt.Sprintf("P%d", step)
+		var got int
+		var err error
+		if step%7 == 0 {
+			// Mix in a non-default allocator so the heaps see stale entries.
+			got, err = lot.ParkCarWithAllocator(&Car{Number: plate}, FarthestFirstAllocator{})
+		} else {
+			got, err = lot.ParkCar(&Car{Number: plate})
+			if want > 0 && got != want {
+				t.Fatalf("step %d: index chose slot %d, scan would choose %d", step, got, want)
+			}
+		}
+		if want < 0 {
+			if err == nil {
+				t.Fatalf("step %d: expected full lot", step)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %d: park: %v", step, err)
+		}
+		parked = append(parked, plate)
+
+		if found, err := lot.FindCar(plate); err != nil || found.Number != got {
+			t.Fatalf("step %d: FindCar(%s) = %v, %v; want slot %d", step, plate, found, err, got)
+		}
+		if lot.FreeSlots() != len(lot.Slots)-len(parked) {
+			t.Fatalf("step %d: FreeSlots = %d, want %d", step, lot.FreeSlots(), len(lot.Slots)-len(parked))
+		}
+	}
+}
+
+func fillLot(b *testing.B, capacity int) *ParkingLot {
+	lot := NewParkingLot("Bench", capacity)
+	for i := 0; i < capacity-1; i++ {
+		if _, err := lot.ParkCar(&Car{Number: fmt.Sprintf("B%d", i)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return lot
+}
+
+var benchSizes = []int{1_000, 10_000, 100_000}
+
+func BenchmarkFindCar(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("slots=%d", n), func(b *testing.B) {
+			lot := fillLot(b, n)
+			plate := fmt.Sprintf("B%d", n-2) // the last car parked, worst case for a scan
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := lot.FindCar(plate); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParkUnparkNearlyFull(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("slots=%d", n), func(b *testing.B) {
+			lot := fillLot(b, n)
+			car := &Car{Number: "CYCLE"}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := lot.ParkCar(car); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := lot.UnparkCar(car.Number); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParkEvenlyAcrossLots(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("slots=%d", n), func(b *testing.B) {
+			manager := NewParkingManager(fillLot(b, n), fillLot(b, n))
+			car := &Car{Number: "EVEN"}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lotName, _, err := manager.ParkEvenly(car)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, lot := range manager.Lots {
+					if lot.Name == lotName {
+						_, _ = lot.UnparkCar(car.Number)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+// journal.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type JournalKind string
+
+const (
+	JournalLot      JournalKind = "lot"      // a lot joined the journal; Layout holds its full state
+	JournalParked   JournalKind = "parked"   // Car was parked at Slot, spanning Span slots
+	JournalCharged  JournalKind = "charged"  // Fee and Lines were quoted for Plate on exit
+	JournalPaid     JournalKind = "paid"     // Payment settled the charged Fee before Plate left
+	JournalRefunded JournalKind = "refunded" // Fee of Payment was given back in Refund
+	JournalUnparked JournalKind = "unparked" // Plate left Slot
+	JournalReverted JournalKind = "reverted" // the entries of change Ref were rolled back
+)
+
+// JournalEntry is one line of the journal. Entries written for the same
+// change share a Change number so a revert can cancel all of them.
+type JournalEntry struct {
+	Seq        uint64
+	Change     uint64
+	Ref        uint64 `json:",omitempty"`
+	Time       time.Time
+	Kind       JournalKind
+	Lot        string
+	Slot       int          `json:",omitempty"`
+	Span       int          `json:",omitempty"`
+	Plate      string       `json:",omitempty"`
+	Attendant  string       `json:",omitempty"`
+	Ticket     string       `json:",omitempty"`
+	LostTicket bool         `json:",omitempty"`
+	Car        *Car         `json:",omitempty"`
+	Fee        Money        `json:",omitzero"`
+	Lines      []FeeLine    `json:",omitempty"`
+	Payment    *Payment     `json:",omitempty"`
+	Refund     *Refund      `json:",omitempty"`
+	Layout     *LotSnapshot `json:",omitempty"`
+}
+
+var ErrJournal = errors.New("could not write journal")
+
+// Journal is an append-only file of JSON entries, one per line, synced to
+// disk after every change.
+type Journal struct {
+	mu      sync.Mutex
+	file    *os.File
+	seq     uint64
+	change  uint64
+	layouts map[string]string // lot name to the layout last journaled for it
+}
+
+// OpenJournal opens or creates the journal at path, continuing the
+// sequence numbers of any entries already in it. A last line left half
+// written by a crash is cut off.
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{layouts: make(map[string]string)}
+	if f, err := os.Open(path); err == nil {
+		entries, size, err := readJournal(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			j.seq = max(j.seq, e.Seq)
+			j.change = max(j.change, e.Change)
+			if e.Kind == JournalLot && e.Layout != nil {
+				j.layouts[e.Lot] = layoutOf(*e.Layout)
+			}
+		}
+		if err := truncateTorn(path, size); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j.file = file
+	return j, nil
+}
+
+// truncateTorn cuts the journal at path back to its first size bytes if
+// anything follows them.
+func truncateTorn(path string, size int64) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == size {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// Append writes the entries as one change and returns its change number.
+func (j *Journal) Append(entries ...JournalEntry) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.change++
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	seq := j.seq
+	for _, e := range entries {
+		seq++
+		e.Seq, e.Change = seq, j.change
+		if err := enc.Encode(e); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrJournal, err)
+		}
+	}
+	if _, err := j.file.Write(buf.Bytes()); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrJournal, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrJournal, err)
+	}
+	j.seq = seq
+	for _, e := range entries {
+		if e.Kind == JournalLot && e.Layout != nil {
+			j.layouts[e.Lot] = layoutOf(*e.Layout)
+		}
+	}
+	return j.change, nil
+}
+
+// hasLayout reports whether the lot's last journaled state has the same
+// slots as snapshot, so replaying the journal already rebuilds the lot.
+func (j *Journal) hasLayout(snapshot LotSnapshot) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	layout, ok := j.layouts[snapshot.Name]
+	return ok && layout == layoutOf(snapshot)
+}
+
+// layoutOf describes the lot's slots apart from what is parked in them.
+func layoutOf(snapshot LotSnapshot) string {
+	type slotLayout struct {
+		Number     int
+		Floor, Row string
+		Position   int
+		Size       VehicleSize
+		Accessible bool
+	}
+	slots := make([]slotLayout, len(snapshot.Slots))
+	for i, s := range snapshot.Slots {
+		slots[i] = slotLayout{s.Number, s.Floor, s.Row, s.Position, s.Size, s.Accessible}
+	}
+	data, _ := json.Marshal(struct {
+		BusSpan int
+		Slots   []slotLayout
+	}{snapshot.BusSpan, slots})
+	return string(data)
+}
+
+// ReadJournal reads every entry in r. A last line without its newline was
+// torn by a crash mid-write and is skipped.
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	entries, _, err := readJournal(r)
+	return entries, err
+}
+
+// readJournal also returns how many bytes the complete lines take up.
+func readJournal(r io.Reader) ([]JournalEntry, int64, error) {
+	var entries []JournalEntry
+	var size int64
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return entries, size, nil // nothing, or a torn last line
+		}
+		if err != nil {
+			return entries, size, err
+		}
+		size += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return entries, size, fmt.Errorf("journal entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// SetJournal starts journaling the lot. Its current state is recorded
+// first so a replay can start from it, unless the journal already holds
+// the lot with the same layout.
+func (pl *ParkingLot) SetJournal(journal *Journal) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	snapshot := pl.snapshotLocked()
+	if !journal.hasLayout(snapshot) {
+		if _, err := journal.Append(JournalEntry{Time: pl.now(), Kind: JournalLot, Lot: pl.Name, Layout: &snapshot}); err != nil {
+			return err
+		}
+	}
+	pl.Journal = journal
+	return nil
+}
+
+func (pm *ParkingManager) SetJournal(journal *Journal) error {
+	for _, lot := range pm.lots() {
+		if err := lot.SetJournal(journal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitLocked makes a change durable: it is journaled first, then written
+// to the store. If the store refuses it the journal gets a revert entry and
+// the caller rolls the change back.
+func (pl *ParkingLot) commitLocked(entries ...JournalEntry) error {
+	now := pl.now()
+	for i := range entries {
+		entries[i].Time = now
+		entries[i].Lot = pl.Name
+	}
+
+	var change uint64
+	if pl.Journal != nil {
+		var err error
+		if change, err = pl.Journal.Append(entries...); err != nil {
+			return err
+		}
+	}
+	if err := pl.persistLocked(); err != nil {
+		if pl.Journal != nil {
+			_, _ = pl.Journal.Append(JournalEntry{Time: now, Kind: JournalReverted, Lot: pl.Name, Ref: change})
+		}
+		return err
+	}
+	return nil
+}
+
+// Replay rebuilds a manager from journal entries. Entries after until are
+// ignored unless until is zero; reverted changes are skipped.
+func Replay(r io.Reader, until time.Time) (*ParkingManager, error) {
+	entries, err := ReadJournal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := revertedChanges(entries)
+	lots := make(map[string]*ParkingLot)
+	var order []string
+	for _, e := range entries {
+		if !until.IsZero() && e.Time.After(until) {
+			break
+		}
+		if reverted[e.Change] {
+			continue
+		}
+		if e.Kind == JournalLot {
+			if _, seen := lots[e.Lot]; !seen {
+				order = append(order, e.Lot)
+			}
+			lots[e.Lot] = LotFromSnapshot(*e.Layout)
+			continue
+		}
+		lot, ok := lots[e.Lot]
+		if !ok {
+			return nil, fmt.Errorf("journal entry %d: lot %q was never registered", e.Seq, e.Lot)
+		}
+		if err := lot.applyJournalEntry(e); err != nil {
+			return nil, fmt.Errorf("journal entry %d: %w", e.Seq, err)
+		}
+	}
+
+	pm := NewParkingManager()
+	for _, name := range order {
+		pm.AddLot(lots[name])
+	}
+	return pm, nil
+}
+
+// revertedChanges returns the change numbers that revert entries cancel.
+func revertedChanges(entries []JournalEntry) map[uint64]bool {
+	reverted := make(map[uint64]bool)
+	for _, e := range entries {
+		if e.Kind == JournalReverted {
+			reverted[e.Ref] = true
+		}
+	}
+	return reverted
+}
+
+func ReplayFile(path string, until time.Time) (*ParkingManager, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Replay(f, until)
+}
+
+// applyJournalEntry redoes a journaled change without queueing events or
+// touching the store and journal.
+func (pl *ParkingLot) applyJournalEntry(e JournalEntry) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	switch e.Kind {
+	case JournalParked:
+		i := pl.slotIndexLocked(e.Slot)
+		span := max(e.Span, 1)
+		if i < 0 || i+span > len(pl.Slots) || e.Car == nil {
+			return pl.errorf(e.Plate, fmt.Errorf("%w %d", ErrUnknownSlot, e.Slot))
+		}
+		if pl.Slots[i].HeldFor != "" { // the car arrived for the reservation holding the slot
+			pl.Slots[i].HeldFor = ""
+			pl.indexLocked().markFree(pl.Slots, i)
+		}
+		car := *e.Car
+		pl.occupyLocked(i, span, &car, e.Attendant)
+		pl.issueTicketLocked(i, e.Ticket)
+	case JournalUnparked:
+		i := pl.findLocked(e.Plate)
+		if i < 0 {
+			return pl.errorf(e.Plate, ErrCarNotFound)
+		}
+		ticket := pl.ticketLocked(i)
+		ticket.Lost, ticket.ExitTime = e.LostTicket, e.Time
+		pl.closeTicketLocked(ticket)
+		pl.releaseLocked(i)
+		pl.pending = nil
+	}
+	return nil
+}
+
+func (pl *ParkingLot) slotIndexLocked(number int) int {
+	for i := range pl.Slots {
+		if pl.Slots[i].Number == number {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,205 @@
+// journal_test.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func journaledManager(t *testing.T, path string, clock Clock) *ParkingManager {
+	t.Helper()
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { journal.Close() })
+
+	manager := NewParkingManager(NewParkingLot("Lot A", 3), NewParkingLot("Lot B", 2))
+	manager.SetClock(clock)
+	if err := manager.SetJournal(journal); err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func TestReplayRebuildsManagerFromJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	manager := journaledManager(t, path, clock)
+	lotA, lotB := manager.Lots[0], manager.Lots[1]
+
+	attendant := &Attendant{Name: "Vik", Lot: lotA}
+	_, _ = attendant.ParkCarForDriver(&Car{Number: "J1", Color: "White"})
+	clock.Advance(10 * time.Minute)
+	_, _ = lotB.ParkCar(&Car{Number: "J2"})
+	clock.Advance(10 * time.Minute)
+	_, _, _ = lotA.UnparkCarAndCharge("J1")
+	clock.Advance(10 * time.Minute)
+	_, _ = lotA.ParkCar(&Car{Number: "J3"})
+
+	replayed, err := ReplayFile(path, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed.Lots) != 2 {
+		t.Fatalf("expected 2 lots, got %d", len(replayed.Lots))
+	}
+	if _, err := replayed.Lots[0].FindCar("J1"); err == nil {
+		t.Error("expected J1 to have left Lot A")
+	}
+	slot, err := replayed.Lots[0].FindCar("J3")
+	if err != nil || slot.Number != 1 || !slot.Car.ParkedAt.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("expected J3 in slot 1 parked at 09:30, got %+v (err %v)", slot, err)
+	}
+	if _, err := replayed.Lots[1].FindCar("J2"); err != nil {
+		t.Errorf("expected J2 in Lot B: %v", err)
+	}
+
+	// Point-in-time replay: before the charge, J1 is still parked.
+	earlier, err := ReplayFile(path, start.Add(15*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, err = earlier.Lots[0].FindCar("J1")
+	if err != nil || slot.AttendantName != "Vik" {
+		t.Errorf("expected J1 parked by Vik at 09:15, got %+v (err %v)", slot, err)
+	}
+	// The replayed manager still rejects duplicates across lots.
+	if _, err := earlier.Lots[1].ParkCar(&Car{Number: "J1"}); !errors.Is(err, ErrDuplicatePlate) {
+		t.Errorf("expected replayed manager to know J1 is parked, got %v", err)
+	}
+}
+
+func TestJournalRecordsChargeForAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	manager := journaledManager(t, path, clock)
+
+	_, _ = manager.Lots[0].ParkCarWithAttendant(&Car{Number: "AUD1"}, "Lata")
+	clock.Advance(7 * time.Minute)
+	_, _, _ = manager.Lots[0].UnparkCarAndCharge("AUD1")
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := ReadJournal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var charged *JournalEntry
+	for i := range entries {
+		if entries[i].Kind == JournalCharged {
+			charged = &entries[i]
+		}
+	}
+	if charged == nil || charged.Fee != Rupees(14) || charged.Attendant != "Lata" || len(charged.Lines) == 0 {
+		t.Fatalf("expected an itemized ₹14 charge by Lata, got %+v", charged)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Seq != entries[i-1].Seq+1 {
+			t.Fatalf("expected consecutive sequence numbers, got %d after %d", entries[i].Seq, entries[i-1].Seq)
+		}
+	}
+
+	// Reopening continues the sequence.
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	if _, err := journal.Append(JournalEntry{Kind: JournalLot, Lot: "X", Layout: &LotSnapshot{Name: "X"}}); err != nil {
+		t.Fatal(err)
+	}
+	f2, _ := os.Open(path)
+	defer f2.Close()
+	all, _ := ReadJournal(f2)
+	if last := all[len(all)-1]; last.Seq != entries[len(entries)-1].Seq+1 {
+		t.Errorf("expected seq %d after reopen, got %d", entries[len(entries)-1].Seq+1, last.Seq)
+	}
+}
+
+func TestReplaySkipsRevertedChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	store := &failingStore{}
+	lot := NewParkingLot("Lot A", 2)
+	_ = lot.SetStore(store)
+	_ = lot.SetJournal(journal)
+
+	_, _ = lot.ParkCar(&Car{Number: "OK1"})
+	store.fail = true
+	_, _ = lot.ParkCar(&Car{Number: "FAILED"})
+
+	replayed, err := ReplayFile(path, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replayed.Lots[0].FindCar("FAILED"); err == nil {
+		t.Error("expected the reverted park to be skipped")
+	}
+	if _, err := replayed.Lots[0].FindCar("OK1"); err != nil {
+		t.Errorf("expected OK1 to be replayed: %v", err)
+	}
+}
+
+func TestJournalRecordsLotOnlyWhenItsLayoutChanges(t *testing.T) {
+	dir := t.TempDir()
+	lotEntries := func() (n int) {
+		t.Helper()
+		f, err := os.Open(filepath.Join(dir, "journal.jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		entries, err := ReadJournal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if e.Kind == JournalLot {
+				n++
+			}
+		}
+		return n
+	}
+	run := func(config string, args ...string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if code := runCLI(dir, writeConfig(t, config), args, &stdout, &stderr); code != exitOK {
+			t.Fatalf("%v: exit %d: %s", args, code, stderr.String())
+		}
+	}
+
+	config := `{"Lots": [{"Name": "Lot A", "Slots": 3, "Accessible": [1]}]}`
+	run(config, "park", "JL1")
+	run(config, "park", "JL2")
+	run(config, "status")
+	if n := lotEntries(); n != 1 {
+		t.Errorf("expected Lot A journaled once, got %d", n)
+	}
+
+	run(`{"Lots": [{"Name": "Lot A", "Slots": 3, "Accessible": [3]}]}`, "status")
+	if n := lotEntries(); n != 2 {
+		t.Errorf("expected the new accessible slot journaled, got %d lot entries", n)
+	}
+	manager, err := ReplayFile(filepath.Join(dir, "journal.jsonl"), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lot := manager.Lots[0]; lot.Slots[0].Accessible || !lot.Slots[2].Accessible || lot.Slots[1].Car == nil {
+		t.Errorf("unexpected replayed lot %+v", lot.Slots)
+	}
+}
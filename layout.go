@@ -0,0 +1,106 @@
+// layout.go
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidLayout = errors.New("invalid layout")
+
+// Layout describes where a lot's slots are: floors of named rows, each row
+// a contiguous range of slot numbers. Together the rows number the lot's
+// slots 1..n with no gaps, in floor and row order.
+type Layout struct {
+	Floors []FloorLayout
+}
+
+type FloorLayout struct {
+	Name string
+	Rows []RowLayout
+}
+
+// RowLayout holds slots First..Last inclusive, all of one size ("" accepts
+// anything up to SizeLarge).
+type RowLayout struct {
+	Name        string
+	First, Last int
+	Size        VehicleSize
+}
+
+// Location is where a slot is within its lot, for gate displays and
+// receipts.
+type Location struct {
+	Floor    string `json:",omitempty"`
+	Row      string
+	Position int // 1-based within the row
+	Slot     int
+}
+
+func (l Location) String() string {
+	s := fmt.Sprintf("Row %s, position %d (slot %d)", l.Row, l.Position, l.Slot)
+	if l.Floor != "" {
+		s = fmt.Sprintf("Floor %s, %s", l.Floor, s)
+	}
+	return s
+}
+
+func (s Slot) Location() Location {
+	return Location{Floor: s.Floor, Row: s.Row, Position: s.Position, Slot: s.Number}
+}
+
+// NewParkingLotWithLayout builds an empty lot with one slot per number in
+// the layout's rows.
+func NewParkingLotWithLayout(name string, layout Layout) (*ParkingLot, error) {
+	if err := layout.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	var slots []Slot
+	for _, floor := range layout.Floors {
+		for _, row := range floor.Rows {
+			for n := row.First; n <= row.Last; n++ {
+				slots = append(slots, Slot{
+					Number:   n,
+					Floor:    floor.Name,
+					Row:      row.Name,
+					Position: n - row.First + 1,
+					Size:     row.Size,
+					IsEmpty:  true,
+				})
+			}
+		}
+	}
+	return &ParkingLot{Name: name, Slots: slots}, nil
+}
+
+func (l Layout) validate() error {
+	next := 1
+	floors := make(map[string]bool)
+	for _, floor := range l.Floors {
+		if floors[floor.Name] {
+			return fmt.Errorf("%w: floor %q is defined twice", ErrInvalidLayout, floor.Name)
+		}
+		floors[floor.Name] = true
+		rows := make(map[string]bool)
+		for _, row := range floor.Rows {
+			switch {
+			case row.Name == "":
+				return fmt.Errorf("%w: floor %q has a row without a name", ErrInvalidLayout, floor.Name)
+			case rows[row.Name]:
+				return fmt.Errorf("%w: floor %q: row %q is defined twice", ErrInvalidLayout, floor.Name, row.Name)
+			case row.First != next || row.Last < row.First:
+				return fmt.Errorf("%w: floor %q: row %q covers %d-%d, want a range starting at %d",
+					ErrInvalidLayout, floor.Name, row.Name, row.First, row.Last, next)
+			}
+			if _, err := ParseVehicleSize(string(row.Size)); err != nil {
+				return fmt.Errorf("%w: floor %q: row %q: %v", ErrInvalidLayout, floor.Name, row.Name, err)
+			}
+			rows[row.Name] = true
+			next = row.Last + 1
+		}
+	}
+	if next == 1 {
+		return fmt.Errorf("%w: no slots", ErrInvalidLayout)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// layout_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLayoutGivesEverySlotFloorRowAndPosition(t *testing.T) {
+	lot, err := NewParkingLotWithLayout("Tower", Layout{Floors: []FloorLayout{
+		{Name: "G", Rows: []RowLayout{{Name: "A", First: 1, Last: 3}, {Name: "B", First: 4, Last: 5, Size: SizeLarge}}},
+		{Name: "1", Rows: []RowLayout{{Name: "A", First: 6, Last: 12}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lot.Slots) != 12 {
+		t.Fatalf("expected 12 slots, got %d", len(lot.Slots))
+	}
+	if s := lot.Slots[4]; s.Floor != "G" || s.Row != "B" || s.Position != 2 || s.Size != SizeLarge {
+		t.Errorf("unexpected slot 5 %+v", s)
+	}
+
+	manager := NewParkingManager(lot)
+	for _, plate := range []string{"L1", "L2", "L3", "L4", "L5", "L6", "L7"} {
+		if _, err := lot.ParkCar(&Car{Number: plate}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	slot, err := lot.FindCar("L7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := slot.Location().String(); got != "Floor 1, Row A, position 2 (slot 7)" {
+		t.Errorf("unexpected location %q", got)
+	}
+	cars := lot.GetAllParkedCars()
+	if c := cars[6]; c.Lot != "Tower" || c.Floor != "1" || c.Row != "A" || c.Position != 2 || c.Slot != 7 {
+		t.Errorf("unexpected parked car %+v", c)
+	}
+	if found := manager.FindCars(CarFilter{}); len(found) != 7 || found[3].Location() != (Location{Floor: "G", Row: "B", Position: 1, Slot: 4}) {
+		t.Errorf("unexpected FindCars locations %+v", found)
+	}
+}
+
+func TestLayoutRejectsGapsAndOverlaps(t *testing.T) {
+	for name, layout := range map[string]Layout{
+		"empty":     {},
+		"gap":       {Floors: []FloorLayout{{Rows: []RowLayout{{Name: "A", First: 1, Last: 3}, {Name: "B", First: 5, Last: 6}}}}},
+		"overlap":   {Floors: []FloorLayout{{Rows: []RowLayout{{Name: "A", First: 1, Last: 3}, {Name: "B", First: 3, Last: 6}}}}},
+		"same row":  {Floors: []FloorLayout{{Rows: []RowLayout{{Name: "A", First: 1, Last: 1}, {Name: "A", First: 2, Last: 2}}}}},
+		"bad size":  {Floors: []FloorLayout{{Rows: []RowLayout{{Name: "A", First: 1, Last: 1, Size: "blimp"}}}}},
+		"unnamed":   {Floors: []FloorLayout{{Rows: []RowLayout{{First: 1, Last: 1}}}}},
+		"backwards": {Floors: []FloorLayout{{Rows: []RowLayout{{Name: "A", First: 1, Last: 0}}}}},
+	} {
+		if _, err := NewParkingLotWithLayout("X", layout); !errors.Is(err, ErrInvalidLayout) {
+			t.Errorf("%s: expected ErrInvalidLayout, got %v", name, err)
+		}
+	}
+}
+
+func TestNewParkingLotPositionsWithinRoundRobinRows(t *testing.T) {
+	lot := NewParkingLot("Lot A", 7)
+	if s := lot.Slots[5]; s.Row != "A" || s.Position != 2 {
+		t.Errorf("expected slot 6 at A2, got %s%d", s.Row, s.Position)
+	}
+}
+
+func TestBusSpansOnlyNeighboursInOneRow(t *testing.T) {
+	lot, err := NewParkingLotWithLayout("Depot", Layout{Floors: []FloorLayout{
+		{Name: "G", Rows: []RowLayout{{Name: "A", First: 1, Last: 1, Size: SizeLarge}, {Name: "B", First: 2, Last: 2, Size: SizeLarge}}},
+		{Name: "1", Rows: []RowLayout{{Name: "B", First: 3, Last: 4, Size: SizeLarge}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lot.BusSpan = 2
+	// Slots 1 and 2 are in different rows, and 2 and 3 on different floors,
+	// so only 3 and 4 make room for the bus.
+	slot, err := lot.ParkCar(&Car{Number: "BUS1", Size: SizeBus})
+	if err != nil || slot != 3 {
+		t.Fatalf("expected the bus on floor 1 at slots 3-4, got %d (err %v)", slot, err)
+	}
+	if _, err := lot.ParkCar(&Car{Number: "BUS2", Size: SizeBus}); err == nil {
+		t.Error("expected a lone large slot to refuse a second bus")
+	}
+}
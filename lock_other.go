@@ -0,0 +1,16 @@
+// lock_other.go
+
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockDir only creates the lock file: without flock, runs sharing a data
+// directory are not kept apart.
+func lockDir(dir string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(dir, ".lock"), os.O_RDWR|os.O_CREATE, 0o644)
+}
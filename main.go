@@ -2,7 +2,14 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -12,38 +19,96 @@ type Car struct {
 	Number     string
 	Color      string
 	Make       string
-	Size       string // "small" or "large"
+	Size       VehicleSize
 	IsHandicap bool
 	ParkedAt   time.Time
+
+	ReservationID string `json:",omitempty"` // set when the car parked on a reservation
+	Pass          string `json:",omitempty"` // ID of the monthly pass that covered the car when it parked
 }
 
 type Slot struct {
 	Number        int
+	Floor         string `json:",omitempty"`
 	Row           string
+	Position      int         // 1-based place within the row
+	Size          VehicleSize // "" accepts anything up to SizeLarge
+	Accessible    bool        // reserved for handicap drivers unless the lot's overflow rule releases it
 	IsEmpty       bool
 	Car           *Car
 	AttendantName string
+	SpanHead      int    // for the extra slots a bus spans, the head slot's Number
+	TicketID      string // ticket issued to the car parked here
+	HeldFor       string `json:",omitempty"` // reservation the empty slot is held for
 }
 
+// ParkingLot guards Slots and Observers with mu; every exported method
+// takes the lock, so a lot can be shared by several gate goroutines.
 type ParkingLot struct {
 	Name      string
 	Slots     []Slot
 	Observers []Observer
+	Clock     Clock         // nil means SystemClock
+	Tariff    Tariff        // nil means DefaultTariff
+	Store     Store         // nil keeps the lot in memory only
+	Journal   *Journal      // nil disables the audit journal
+	BusSpan   int           // adjacent large slots a bus may take when no bus slot is free; 0 disables
+	Allocator SlotAllocator // nil means DefaultAllocator
+
+	AccessibleOverflow OverflowRule // nil keeps accessible slots for handicap drivers only
+	EventObservers     []EventObserver
+
+	mu     sync.RWMutex
+	plates *plateRegistry // shared with the owning manager's other lots
+	idx    *slotIndex     // built on the first write; see indexLocked
+
+	pending   []Event // queued under mu, delivered by update
+	subs      []*Subscription
+	observers *Subscription // runs Observers and EventObservers off the gate's goroutine
+	nextTurn  uint64        // handed out under mu, so updates deliver in the order they ran
+	turns     eventTurns
+
+	closedTickets map[string]Ticket // tickets already used to exit, to catch duplicates
+	closedQueue   []Ticket          // the same tickets by exit time, to expire them
+
+	ReservationGrace time.Duration  // 0 means DefaultReservationGrace
+	reservations     []*Reservation // by Start
+
+	Passes    *PassRegistry // nil means no pass holders; shared by a manager's lots
+	passSweep passSweep
+
+	Payments  PaymentProcessor // nil means DefaultPayments
+	checkouts map[string]bool  // tickets whose exit payment is in progress
+	receipts  memoryReceipts   // when the store does not keep receipts
+	refundMu  sync.Mutex
+
+	Pricing Pricing // currency, taxes and rounding on top of the tariff
 }
 
 type Attendant struct {
-	Name string
-	Lot  *ParkingLot
+	Name      string
+	Lot       *ParkingLot
+	Allocator SlotAllocator // nil means the lot's allocator
 }
 
+// ParkingManager should be built with NewParkingManager. A manager written
+// as a struct literal only joins its lots' plate registries on its first
+// method call; until then a plate can be parked in two of its lots
+// directly.
 type ParkingManager struct {
-	Lots []*ParkingLot
+	Lots   []*ParkingLot
+	Clock  Clock         // nil means SystemClock
+	Passes *PassRegistry // nil until SetPasses or the first AddPass
+
+	mu       sync.RWMutex
+	plates   *plateRegistry
+	attached map[*ParkingLot]bool
 }
 
 type CarFilter struct {
 	Color      string
 	Make       string
-	Size       string
+	Size       VehicleSize
 	IsHandicap *bool // use pointer to distinguish unset vs false
 }
 
@@ -51,8 +116,32 @@ type CarWithAttendant struct {
 	Car
 	Attendant string
 	Row       string
+	Lot       string
+	Floor     string
+	Slot      int
+	Position  int
+}
+
+func (c CarWithAttendant) Location() Location {
+	return Location{Floor: c.Floor, Row: c.Row, Position: c.Position, Slot: c.Slot}
+}
+
+// parkedCar reports the car in a head slot with its full location.
+func (pl *ParkingLot) parkedCar(slot Slot) CarWithAttendant {
+	return CarWithAttendant{
+		Car:       *slot.Car,
+		Attendant: slot.AttendantName,
+		Row:       slot.Row,
+		Lot:       pl.Name,
+		Floor:     slot.Floor,
+		Slot:      slot.Number,
+		Position:  slot.Position,
+	}
 }
 
+// NewParkingLot deals the slots out to rows A–E in turn, so slot 1 is A1,
+// slot 2 is B1 and slot 6 is A2. Use NewParkingLotWithLayout to describe
+// real floors and rows.
 func NewParkingLot(name string, capacity int) *ParkingLot {
 	slots := make([]Slot, capacity)
 	rowLetters := []string{"A", "B", "C", "D", "E"}
@@ -60,198 +149,754 @@ func NewParkingLot(name string, capacity int) *ParkingLot {
 	for i := range slots {
 		row := rowLetters[i%len(rowLetters)]
 		slots[i] = Slot{
-			Number:  i + 1,
-			Row:     row,
-			IsEmpty: true,
+			Number:   i + 1,
+			Row:      row,
+			Position: i/len(rowLetters) + 1,
+			IsEmpty:  true,
 		}
 	}
 	return &ParkingLot{Name: name, Slots: slots}
 }
 
+// NewParkingLotWithSizes builds a lot with one slot per entry in sizes,
+// numbered and assigned to rows the same way as NewParkingLot.
+func NewParkingLotWithSizes(name string, sizes ...VehicleSize) *ParkingLot {
+	lot := NewParkingLot(name, len(sizes))
+	for i, size := range sizes {
+		lot.Slots[i].Size = size
+	}
+	return lot
+}
+
+func (pl *ParkingLot) now() time.Time {
+	if pl.Clock == nil {
+		return SystemClock.Now()
+	}
+	return pl.Clock.Now()
+}
+
 func (pl *ParkingLot) ParkCar(car *Car) (int, error) {
+	return pl.park(car, "", nil)
+}
+
+// ParkCarWithAllocator parks the car using the given allocator instead of
+// the lot's own.
+func (pl *ParkingLot) ParkCarWithAllocator(car *Car, allocator SlotAllocator) (int, error) {
+	return pl.park(car, "", allocator)
+}
+
+func (pl *ParkingLot) park(car *Car, attendantName string, allocator SlotAllocator) (slot int, err error) {
+	pl.update(func() {
+		slot, err = pl.parkAndCommitLocked(car, attendantName, allocator)
+	})
+	return slot, err
+}
+
+// parkAndCommitLocked is the single entry path: it parks the car, issues
+// its ticket and makes the change durable, rolling back if that fails.
+func (pl *ParkingLot) parkAndCommitLocked(car *Car, attendantName string, allocator SlotAllocator) (int, error) {
+	if err := pl.sweepReservationsLocked(); err != nil {
+		return -1, pl.errorf(car.Number, err)
+	}
+	mark := len(pl.pending)
+	slot, err := pl.parkLocked(car, attendantName, allocator)
+	if err != nil {
+		return -1, err
+	}
+	i := pl.idx.byPlate[car.Number]
+	parked := *car
+	entry := JournalEntry{Kind: JournalParked, Slot: slot, Span: pl.spanLocked(i), Plate: car.Number,
+		Ticket: pl.Slots[i].TicketID, Attendant: attendantName, Car: &parked}
+	if err := pl.commitLocked(entry); err != nil {
+		pl.undoParkLocked(car, mark)
+		if r := pl.reservationLocked(car.ReservationID); r != nil {
+			r.Status = ReservationBooked // held again on the next sweep
+			car.ReservationID = ""
+		}
+		car.Pass = ""
+		return -1, pl.errorf(car.Number, err)
+	}
+	return slot, nil
+}
+
+func (pl *ParkingLot) SetAllocator(allocator SlotAllocator) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.Allocator = allocator
+}
+
+// parkLocked claims the plate, so the same car cannot be parked twice under
+// one manager, places the car and queues the resulting events.
+func (pl *ParkingLot) parkLocked(car *Car, attendantName string, allocator SlotAllocator) (int, error) {
+	slot, err := pl.claimAndPlaceLocked(car, attendantName, allocator)
+	if err != nil {
+		pl.queueLocked(Event{Kind: EventParkRejected, Plate: car.Number, Attendant: attendantName, Reason: err.Error()})
+		return -1, err
+	}
+	i := pl.idx.byPlate[car.Number]
+	pl.issueTicketLocked(i, newTicketID())
+	pl.queueLocked(slotEvent(EventParked, pl.Slots[i]))
+	if pl.idx.total == 0 {
+		pl.queueLocked(Event{Kind: EventFull})
+	}
+	return slot, nil
+}
+
+func (pl *ParkingLot) claimAndPlaceLocked(car *Car, attendantName string, allocator SlotAllocator) (int, error) {
+	if err := pl.claimPlateLocked(car.Number); err != nil {
+		return -1, err
+	}
+	reservation := pl.arrivalLocked(car.Number)
+	pass, hasPass := pl.passLocked(car.Number)
+	slot := -1
+	if reservation != nil {
+		slot = pl.placeReservedLocked(reservation, car, attendantName)
+	} else if hasPass && pass.Slot != 0 {
+		slot = pl.placeOnPassLocked(pass, car, attendantName)
+	}
+	if slot < 0 {
+		var err error
+		if slot, err = pl.placeLocked(car, attendantName, allocator); err != nil {
+			pl.releasePlateLocked(car.Number)
+			return -1, err
+		}
+	}
+	if reservation != nil {
+		reservation.Status = ReservationFulfilled
+		car.ReservationID = reservation.ID
+	}
+	if hasPass {
+		car.Pass = pass.ID
+	}
+	car.ParkedAt = pl.now()
+	if pl.plates != nil {
+		pl.plates.setSlot(car.Number, pl, slot)
+	}
+	return slot, nil
+}
+
+// placeLocked offers the free compatible slots to the allocator (falling
+// back to the lot's allocator, then DefaultAllocator). A bus with no bus
+// slot takes the first run of BusSpan adjacent large slots.
+func (pl *ParkingLot) placeLocked(car *Car, attendantName string, allocator SlotAllocator) (int, error) {
+	if allocator == nil {
+		allocator = pl.Allocator
+	}
+	if allocator == nil {
+		allocator = DefaultAllocator
+	}
+
+	idx := pl.indexLocked()
+	if idx.total == 0 {
+		return -1, pl.errorf(car.Number, ErrLotFull)
+	}
+
+	// Handicap drivers are offered only the accessible slots while any of
+	// them is free; other cars are kept out of accessible slots unless the
+	// overflow rule has released them.
+	released := !car.IsHandicap && pl.accessibleReleasedLocked()
+	if _, ok := allocator.(FirstFreeAllocator); ok {
+		if i := idx.firstFree(pl.Slots, car, released); i >= 0 {
+			pl.occupyLocked(i, 1, car, attendantName)
+			return pl.Slots[i].Number, nil
+		}
+	}
+
+	var free, accessible []Slot
+	var index, accessibleIndex []int
+	blocked := false
 	for i := range pl.Slots {
-		if pl.Slots[i].IsEmpty {
-			pl.Slots[i].Car = car
-			pl.Slots[i].IsEmpty = false
-			car.ParkedAt = time.Now()
+		slot := pl.Slots[i]
+		if !slot.open() || !car.Size.FitsIn(slot.Size) {
+			continue
+		}
+		if slot.Accessible && car.IsHandicap {
+			accessible = append(accessible, slot)
+			accessibleIndex = append(accessibleIndex, i)
+		}
+		if slot.Accessible && !car.IsHandicap && !released {
+			blocked = true
+			continue
+		}
+		free = append(free, slot)
+		index = append(index, i)
+	}
+	if len(accessible) > 0 {
+		free, index = accessible, accessibleIndex
+	}
+	if len(free) > 0 {
+		choice := allocator.Choose(free, car)
+		if choice < 0 || choice >= len(free) {
+			return -1, pl.errorf(car.Number, ErrNoSlotOffered)
+		}
+		i := index[choice]
+		pl.occupyLocked(i, 1, car, attendantName)
+		return pl.Slots[i].Number, nil
+	}
+	if car.Size.Class() == SizeBus && pl.BusSpan > 1 {
+		if i := pl.findSpanLocked(pl.BusSpan, Slot.open); i >= 0 {
+			pl.occupyLocked(i, pl.BusSpan, car, attendantName)
 			return pl.Slots[i].Number, nil
 		}
 	}
-	return -1, fmt.Errorf("parking lot is full")
+	if blocked {
+		return -1, pl.errorf(car.Number, ErrAccessibleOnly)
+	}
+	for _, slot := range pl.Slots {
+		if slot.open() {
+			return -1, pl.errorf(car.Number, fmt.Errorf("%w: no free slot fits a %s vehicle", ErrIncompatibleVehicle, car.Size.Class()))
+		}
+	}
+	return -1, pl.errorf(car.Number, ErrLotFull)
 }
-func (pl *ParkingLot) UnparkCar(carNumber string) (int, error) {
+
+// findSpanLocked returns the index of the first run of span adjacent large
+// slots that are all usable, or -1.
+func (pl *ParkingLot) findSpanLocked(span int, usable func(Slot) bool) int {
+	run := 0
 	for i := range pl.Slots {
-		if !pl.Slots[i].IsEmpty && pl.Slots[i].Car.Number == carNumber {
-			pl.Slots[i].Car = nil
-			pl.Slots[i].IsEmpty = true
-			return pl.Slots[i].Number, nil
+		slot := &pl.Slots[i]
+		prev := &pl.Slots[max(i-1, 0)]
+		adjacent := i > 0 && slot.Floor == prev.Floor && slot.Row == prev.Row && slot.Position == prev.Position+1
+		if usable(*slot) && !slot.Accessible && slotClass(slot.Size) == SizeLarge {
+			if adjacent {
+				run++
+			} else {
+				run = 1
+			}
+		} else {
+			run = 0
+		}
+		if run == span {
+			return i - span + 1
+		}
+	}
+	return -1
+}
+
+// SetBusSpan sets how many adjacent large slots a bus may take. Buses
+// already parked keep the slots they have.
+func (pl *ParkingLot) SetBusSpan(span int) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.BusSpan == span {
+		return nil
+	}
+	pl.BusSpan = span
+	return pl.persistLocked()
+}
+
+func (pl *ParkingLot) occupyLocked(i, span int, car *Car, attendantName string) {
+	idx := pl.indexLocked()
+	idx.byPlate[car.Number] = i
+	for j := i; j < i+span; j++ {
+		idx.markTaken(pl.Slots, j)
+		pl.Slots[j].Car = car
+		pl.Slots[j].IsEmpty = false
+		pl.Slots[j].AttendantName = attendantName
+		if j > i {
+			pl.Slots[j].SpanHead = pl.Slots[i].Number
+		}
+	}
+}
+
+// findLocked returns the index of the head slot holding the plate, or -1.
+// Before the first write has built the index it falls back to a scan.
+func (pl *ParkingLot) findLocked(carNumber string) int {
+	if pl.idx != nil {
+		i, ok := pl.idx.byPlate[carNumber]
+		if !ok || pl.Slots[i].IsEmpty || pl.Slots[i].Car.Number != carNumber {
+			return -1
+		}
+		return i
+	}
+	for i := range pl.Slots {
+		if !pl.Slots[i].IsEmpty && pl.Slots[i].SpanHead == 0 && pl.Slots[i].Car.Number == carNumber {
+			return i
 		}
 	}
-	return -1, fmt.Errorf("car not found")
+	return -1
+}
+
+// releaseLocked empties the head slot at i and every slot spanned with it,
+// queueing an unparked event and, if the lot was full, an available one.
+// A slot dedicated to a pass is held for the holder again.
+func (pl *ParkingLot) releaseLocked(i int) {
+	idx := pl.indexLocked()
+	wasFull := idx.total == 0
+	left := slotEvent(EventUnparked, pl.Slots[i])
+	delete(idx.byPlate, pl.Slots[i].Car.Number)
+	delete(idx.byTicket, pl.Slots[i].TicketID)
+	pl.Slots[i].TicketID = ""
+	pl.releasePlateLocked(pl.Slots[i].Car.Number)
+	head := pl.Slots[i].Number
+	for j := i; j < len(pl.Slots); j++ {
+		if j > i && pl.Slots[j].SpanHead != head {
+			break
+		}
+		pl.Slots[j].Car = nil
+		pl.Slots[j].IsEmpty = true
+		pl.Slots[j].AttendantName = ""
+		pl.Slots[j].SpanHead = 0
+		idx.markFree(pl.Slots, j)
+		pl.holdForPassLocked(j)
+	}
+
+	pl.queueLocked(left)
+	if wasFull && idx.total > 0 {
+		pl.queueLocked(Event{Kind: EventAvailable})
+	}
+}
+
+func (pl *ParkingLot) UnparkCar(carNumber string) (int, error) {
+	ticket, _, err := pl.unpark(exitRequest{plate: carNumber})
+	if err != nil {
+		return -1, err
+	}
+	return ticket.Slot, nil
+}
+
+// unpark is the single exit path. With charge set the stay is priced by
+// the lot's tariff and a charged event precedes the unparked one.
+func (pl *ParkingLot) unpark(req exitRequest) (ticket Ticket, quote FeeQuote, err error) {
+	pl.update(func() {
+		i, ferr := pl.exitSlotLocked(req)
+		if ferr != nil {
+			err = ferr
+			return
+		}
+		mark := len(pl.pending)
+		car, attendant, span := pl.Slots[i].Car, pl.Slots[i].AttendantName, pl.spanLocked(i)
+		ticket = pl.ticketLocked(i)
+		ticket.Lost = req.lostTicket
+		ticket.ExitTime = pl.now()
+
+		var entries []JournalEntry
+		if req.charge {
+			if req.quote != nil {
+				quote = *req.quote
+			} else {
+				quote = pl.quoteLocked(*car, req.lostTicket)
+			}
+			charged := slotEvent(EventCharged, pl.Slots[i])
+			charged.Fee = quote.Total
+			pl.queueLocked(charged)
+			entries = append(entries, JournalEntry{Kind: JournalCharged, Slot: ticket.Slot, Plate: car.Number,
+				Ticket: ticket.ID, Attendant: attendant, Fee: quote.Total, Lines: quote.Lines})
+		}
+		if req.payment != nil {
+			delete(pl.checkouts, ticket.ID)
+			entries = append(entries, JournalEntry{Kind: JournalPaid, Slot: ticket.Slot, Plate: car.Number,
+				Ticket: ticket.ID, Attendant: attendant, Fee: req.payment.Amount, Payment: req.payment})
+		}
+		entries = append(entries, JournalEntry{Kind: JournalUnparked, Slot: ticket.Slot, Plate: car.Number,
+			Ticket: ticket.ID, LostTicket: req.lostTicket, Attendant: attendant})
+		pl.releaseLocked(i)
+		pl.closeTicketLocked(ticket)
+		// The used ticket is saved first: if the exit then fails, loading
+		// skips it as the car still holds it.
+		cerr := pl.saveClosedTicketLocked(ticket)
+		if cerr == nil {
+			cerr = pl.commitLocked(entries...)
+		}
+		if cerr != nil {
+			pl.undoUnparkLocked(i, span, car, attendant, ticket.ID, mark)
+			ticket, quote, err = Ticket{}, FeeQuote{}, pl.errorf(car.Number, cerr)
+			return
+		}
+		pl.dropReservationLocked(car.ReservationID)
+	})
+	return ticket, quote, err
 }
 func (pl *ParkingLot) IsFull() bool {
+	return pl.FreeSlots() == 0
+}
+
+func (pl *ParkingLot) SetClock(clock Clock) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.Clock = clock
+}
+
+func (pl *ParkingLot) FreeSlots() int {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	if pl.idx != nil {
+		return pl.idx.total
+	}
+	free := 0
 	for _, slot := range pl.Slots {
-		if slot.IsEmpty {
-			return false
+		if slot.open() {
+			free++
 		}
 	}
-	return true
+	return free
 }
 
-func (pl *ParkingLot) NotifyObservers(message string) {
-	for _, observer := range pl.Observers {
-		observer(message)
+type LotStatus struct {
+	Name     string
+	Capacity int
+	Occupied int
+	Free     int
+	Full     bool
+}
+
+func (pl *ParkingLot) Status() LotStatus {
+	free := pl.FreeSlots()
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	return LotStatus{
+		Name:     pl.Name,
+		Capacity: len(pl.Slots),
+		Occupied: len(pl.Slots) - free,
+		Free:     free,
+		Full:     free == 0,
 	}
 }
 
-func (pl *ParkingLot) ParkCarWithNotification(car *Car) (int, error) {
-	slot, err := pl.ParkCar(car)
-	if err != nil {
-		pl.NotifyObservers("FULL")
+// hasSlotFor reports whether the vehicle could park in the lot at all,
+// were it empty.
+func (pl *ParkingLot) hasSlotFor(size VehicleSize) bool {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	for _, slot := range pl.Slots {
+		if size.FitsIn(slot.Size) {
+			return true
+		}
 	}
-	return slot, err
+	return size.Class() == SizeBus && pl.BusSpan > 1 &&
+		pl.findSpanLocked(pl.BusSpan, func(Slot) bool { return true }) >= 0
 }
 
-func (pl *ParkingLot) UnparkCarWithNotification(carNumber string) (int, error) {
-	for i := range pl.Slots {
-		if !pl.Slots[i].IsEmpty && pl.Slots[i].Car.Number == carNumber {
-			pl.Slots[i].Car = nil
-			pl.Slots[i].IsEmpty = true
-			pl.NotifyObservers("AVAILABLE")
-			return pl.Slots[i].Number, nil
+// FreeSlotsFor counts the places a vehicle of the given size could park,
+// including bus-sized runs of large slots when the lot allows spanning.
+func (pl *ParkingLot) FreeSlotsFor(size VehicleSize) int {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	if idx := pl.idx; idx != nil {
+		free := idx.freeFor(size.rank())
+		if size.Class() == SizeBus && pl.BusSpan > 1 {
+			free += idx.free[SizeLarge.rank()][0] / pl.BusSpan
+		}
+		return free
+	}
+	free, large := 0, 0
+	for _, slot := range pl.Slots {
+		if !slot.open() {
+			continue
+		}
+		if size.FitsIn(slot.Size) {
+			free++
+		} else if slotClass(slot.Size) == SizeLarge {
+			large++
 		}
 	}
-	return -1, fmt.Errorf("car not found")
+	if size.Class() == SizeBus && pl.BusSpan > 1 {
+		free += large / pl.BusSpan
+	}
+	return free
+}
+
+// NotifyObservers copies the observer list under the lock and calls the
+// observers outside it, so an observer may safely call back into the lot.
+func (pl *ParkingLot) NotifyObservers(message string) {
+	pl.mu.RLock()
+	observers := append([]Observer(nil), pl.Observers...)
+	pl.mu.RUnlock()
+
+	for _, observer := range observers {
+		callSafely(pl.Name, func() { observer(message) })
+	}
+}
+
+func (pl *ParkingLot) AddObserver(observer Observer) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.Observers = append(pl.Observers, observer)
+}
+
+// ParkCarWithNotification and UnparkCarWithNotification predate events;
+// every park and unpark path now notifies observers, so they are plain
+// aliases kept for existing callers.
+func (pl *ParkingLot) ParkCarWithNotification(car *Car) (int, error) {
+	return pl.ParkCar(car)
+}
+
+func (pl *ParkingLot) UnparkCarWithNotification(carNumber string) (int, error) {
+	return pl.UnparkCar(carNumber)
 }
 
 func (a *Attendant) ParkCarForDriver(car *Car) (int, error) {
 	fmt.Printf("Attendant %s is parking car %s\n", a.Name, car.Number)
-	return a.Lot.ParkCarWithAttendant(car, a.Name)
+	return a.Lot.parkWithAttendant(car, a.Name, a.Allocator)
 }
 
 func (pl *ParkingLot) ParkCarWithAttendant(car *Car, attendantName string) (int, error) {
-	for i := range pl.Slots {
-		if pl.Slots[i].IsEmpty {
-			pl.Slots[i].Car = car
-			pl.Slots[i].IsEmpty = false
-			pl.Slots[i].AttendantName = attendantName
-			car.ParkedAt = time.Now()
-			return pl.Slots[i].Number, nil
-		}
-	}
-	return -1, fmt.Errorf("lot is full")
+	return pl.parkWithAttendant(car, attendantName, nil)
+}
+
+func (pl *ParkingLot) parkWithAttendant(car *Car, attendantName string, allocator SlotAllocator) (int, error) {
+	return pl.park(car, attendantName, allocator)
 }
 
+// FindCar returns a copy of the slot holding the car; the copy stays valid
+// after the lock is released even if the car is later unparked.
 func (pl *ParkingLot) FindCar(carNumber string) (*Slot, error) {
-	for i := range pl.Slots {
-		if !pl.Slots[i].IsEmpty && pl.Slots[i].Car.Number == carNumber {
-			return &pl.Slots[i], nil
-		}
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	i := pl.findLocked(carNumber)
+	if i < 0 {
+		return nil, pl.errorf(carNumber, ErrCarNotFound)
 	}
-	return nil, fmt.Errorf("car %s not found in lot", carNumber)
+	slot := pl.Slots[i]
+	car := *slot.Car
+	slot.Car = &car
+	return &slot, nil
 }
 func (pl *ParkingLot) UnparkCarAndCharge(carNumber string) (int, int, error) {
-	for i := range pl.Slots {
-		slot := &pl.Slots[i]
-		if !slot.IsEmpty && slot.Car.Number == carNumber {
-			duration := int(time.Since(slot.Car.ParkedAt).Minutes())
-			if duration == 0 {
-				duration = 1 // minimum charge for <1 minute
-			}
-			fee := duration * 2 // ₹2 per minute
+	slotNum, quote, err := pl.UnparkCarWithQuote(carNumber)
+	if err != nil {
+		return -1, 0, err
+	}
+	return slotNum, quote.Total.Rupees(), nil
+}
+
+// UnparkCarWithQuote frees the car's slot and returns the itemized fee
+// computed by the lot's tariff at the moment of exit.
+func (pl *ParkingLot) UnparkCarWithQuote(carNumber string) (int, FeeQuote, error) {
+	ticket, quote, err := pl.unpark(exitRequest{plate: carNumber, charge: true})
+	if err != nil {
+		return -1, FeeQuote{}, err
+	}
+	return ticket.Slot, quote, nil
+}
 
-			slot.Car = nil
-			slot.IsEmpty = true
-			pl.NotifyObservers("AVAILABLE")
-			return slot.Number, fee, nil
+// QuoteFee prices the car's stay as if it left now, without unparking it.
+func (pl *ParkingLot) QuoteFee(carNumber string) (FeeQuote, error) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	i := pl.findLocked(carNumber)
+	if i < 0 {
+		return FeeQuote{}, pl.errorf(carNumber, ErrCarNotFound)
+	}
+	return pl.quoteLocked(*pl.Slots[i].Car, false), nil
+}
+
+func (pl *ParkingLot) SetTariff(tariff Tariff) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.Tariff = tariff
+}
+
+// quoteLocked prices the car's stay: the tariff, then the pass discount,
+// booking fee and any lost-ticket penalty, then the lot's taxes and
+// rounding.
+func (pl *ParkingLot) quoteLocked(car Car, lostTicket bool) FeeQuote {
+	tariff := pl.Tariff
+	if tariff == nil {
+		tariff = DefaultTariff
+	}
+	quote := tariff.Quote(car, car.ParkedAt, pl.now())
+	// A pass replaced since the car parked still applies; a removed one
+	// does not.
+	if pass, ok := pl.Passes.Lookup(car.Number); ok && car.Pass != "" && pass.ID == car.Pass {
+		pass.discount(&quote)
+	}
+	if car.ReservationID != "" {
+		r := Reservation{ID: car.ReservationID, Lot: pl.Name, Plate: car.Number}
+		if booked := pl.reservationLocked(car.ReservationID); booked != nil {
+			r = *booked
 		}
+		if fee := pl.reservationPricesLocked(func(p ReservationPricer) int { return p.ReservationFee(r) }); fee > 0 {
+			quote.add(LineBase, "Reservation fee", Rupees(fee))
+		}
+	}
+	if lostTicket {
+		pl.lostTicketLine(&quote, car)
 	}
-	return -1, 0, fmt.Errorf("car not found")
+	pl.Pricing.price(&quote)
+	return quote
 }
 
-func (pm *ParkingManager) ParkEvenly(car *Car) (string, int, error) {
-	var targetLot *ParkingLot
-	maxFree := -1
+func (pm *ParkingManager) AddLot(lot *ParkingLot) {
+	pm.mu.Lock()
+	pm.Lots = append(pm.Lots, lot)
+	pm.attachLotsLocked()
+	passes := pm.Passes
+	pm.mu.Unlock()
+	if passes != nil {
+		lot.SetPasses(passes)
+	}
+}
+
+func (pm *ParkingManager) now() time.Time {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if pm.Clock == nil {
+		return SystemClock.Now()
+	}
+	return pm.Clock.Now()
+}
 
+// SetClock installs the clock on the manager and on every lot it manages so
+// that fees and duration queries all agree on the current time.
+func (pm *ParkingManager) SetClock(clock Clock) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.Clock = clock
 	for _, lot := range pm.Lots {
-		freeSlots := 0
-		for _, slot := range lot.Slots {
-			if slot.IsEmpty {
-				freeSlots++
+		lot.SetClock(clock)
+	}
+}
+
+func (pm *ParkingManager) lots() []*ParkingLot {
+	pm.mu.RLock()
+	if pm.allAttachedLocked() {
+		defer pm.mu.RUnlock()
+		return append([]*ParkingLot(nil), pm.Lots...)
+	}
+	pm.mu.RUnlock()
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.attachLotsLocked()
+	return append([]*ParkingLot(nil), pm.Lots...)
+}
+
+// parkInMostFree parks the car in the lot with the most free slots. Free
+// counts are only a snapshot, so if another gate fills the chosen lot first
+// the remaining lots are tried in turn. A duplicate plate stops the search.
+func (pm *ParkingManager) parkInMostFree(car *Car, attendantName string) (string, int, error) {
+	lots := pm.lots()
+	tried := make(map[*ParkingLot]bool, len(lots))
+
+	// A car arriving for a reservation, or with a pass for a dedicated
+	// slot, goes to the lot holding its slot.
+	for _, lot := range lots {
+		if lot.HasReservation(car.Number) || lot.HasDedicatedSlot(car.Number) {
+			tried[lot] = true
+			slotNum, err := lot.ParkCarWithAttendant(car, attendantName)
+			if err == nil {
+				return lot.Name, slotNum, nil
 			}
-		}
-		if freeSlots > maxFree {
-			maxFree = freeSlots
-			targetLot = lot
+			if errors.Is(err, ErrDuplicatePlate) {
+				return "", -1, err
+			}
+			break
 		}
 	}
 
-	if targetLot == nil {
-		return "", -1, fmt.Errorf("all lots are full")
-	}
+	// Pass holders try the lots their pass covers before the others.
+	pm.mu.RLock()
+	pass, hasPass := pm.Passes.Lookup(car.Number)
+	pm.mu.RUnlock()
+	now := pm.now()
+	covered := func(lot *ParkingLot) bool { return hasPass && pass.Covers(lot.Name, now) }
+	for range lots {
+		var targetLot *ParkingLot
+		maxFree := 0
+		for _, lot := range lots {
+			if tried[lot] {
+				continue
+			}
+			free := lot.FreeSlotsFor(car.Size)
+			if free > 0 && (targetLot == nil || covered(lot) && !covered(targetLot) ||
+				covered(lot) == covered(targetLot) && free > maxFree) {
+				maxFree = free
+				targetLot = lot
+			}
+		}
+		if targetLot == nil {
+			break
+		}
+		tried[targetLot] = true
 
-	slotNum, err := targetLot.ParkCar(car)
-	if err != nil {
+		slotNum, err := targetLot.ParkCarWithAttendant(car, attendantName)
+		if err == nil {
+			return targetLot.Name, slotNum, nil
+		}
+		if errors.Is(err, ErrDuplicatePlate) {
+			return "", -1, err
+		}
+	}
+	// The plate may be parked in a lot that had no free slot to try.
+	if err := pm.registry().check(car.Number); err != nil {
 		return "", -1, err
 	}
-	return targetLot.Name, slotNum, nil
+	if !slices.ContainsFunc(lots, func(lot *ParkingLot) bool { return lot.hasSlotFor(car.Size) }) {
+		return "", -1, &LotError{Plate: car.Number,
+			Err: fmt.Errorf("%w: no lot has a slot for a %s vehicle", ErrIncompatibleVehicle, car.Size.Class())}
+	}
+	return "", -1, &LotError{Plate: car.Number, Err: ErrAllLotsFull}
 }
 
+func (pm *ParkingManager) ParkEvenly(car *Car) (string, int, error) {
+	return pm.parkInMostFree(car, "")
+}
+
+// ParkEvenlyWithAttendant is ParkEvenly with the ticket recording the
+// attendant who parked the car.
+func (pm *ParkingManager) ParkEvenlyWithAttendant(car *Car, attendantName string) (string, int, error) {
+	return pm.parkInMostFree(car, attendantName)
+}
+
+// ParkCarWithStrategy parks with the attendant's allocator when one is
+// set. Without one, handicap drivers get the nearest (lowest-numbered) slot
+// and everyone else goes through the lot's allocator.
 func (a *Attendant) ParkCarWithStrategy(car *Car) (int, error) {
-	if car.IsHandicap {
-		// Handicap: nearest available slot (lowest slot number)
-		for i := range a.Lot.Slots {
-			if a.Lot.Slots[i].IsEmpty {
-				return a.Lot.ParkCar(car) // default behavior already parks in lowest first
-			}
+	if car.IsHandicap && a.Allocator == nil {
+		slot, err := a.Lot.parkWithAttendant(car, a.Name, DefaultAllocator)
+		if err != nil {
+			return -1, fmt.Errorf("no available slot for handicap driver: %w", err)
 		}
-		return -1, fmt.Errorf("no available slot for handicap driver")
+		return slot, nil
 	}
 
-	// Default strategy for non-handicap
 	return a.ParkCarForDriver(car)
 }
 
 func (pm *ParkingManager) ParkLargeVehicle(car *Car) (string, int, error) {
-	if car.Size != "large" {
-		return "", -1, fmt.Errorf("not a large vehicle")
+	if class := car.Size.Class(); class != SizeLarge && class != SizeBus {
+		return "", -1, &LotError{Plate: car.Number, Err: fmt.Errorf("%w: not a large vehicle", ErrIncompatibleVehicle)}
 	}
 
-	var targetLot *ParkingLot
-	maxFree := -1
+	return pm.parkInMostFree(car, "")
+}
 
-	for _, lot := range pm.Lots {
-		free := 0
-		for _, slot := range lot.Slots {
-			if slot.IsEmpty {
-				free++
-			}
+// Lot returns the managed lot with the given name.
+func (pm *ParkingManager) Lot(name string) (*ParkingLot, error) {
+	for _, lot := range pm.lots() {
+		if lot.Name == name {
+			return lot, nil
 		}
-		if free > maxFree {
-			maxFree = free
-			targetLot = lot
-		}
-	}
-
-	if targetLot == nil {
-		return "", -1, fmt.Errorf("no lot has space for large vehicle")
 	}
+	return nil, &LotError{Lot: name, Err: ErrUnknownLot}
+}
 
-	slot, err := targetLot.ParkCar(car)
-	if err != nil {
-		return "", -1, err
+// FindCar looks the plate up in every managed lot.
+func (pm *ParkingManager) FindCar(carNumber string) (string, *Slot, error) {
+	for _, lot := range pm.lots() {
+		if slot, err := lot.FindCar(carNumber); err == nil {
+			return lot.Name, slot, nil
+		}
 	}
-	return targetLot.Name, slot, nil
+	return "", nil, &LotError{Plate: carNumber, Err: ErrCarNotFound}
 }
 
 func (pm *ParkingManager) FindCarsByColor(color string) []Car {
 	var result []Car
-	for _, lot := range pm.Lots {
+	for _, lot := range pm.lots() {
+		lot.mu.RLock()
 		for _, slot := range lot.Slots {
-			if !slot.IsEmpty && slot.Car.Color == color {
+			if !slot.IsEmpty && slot.SpanHead == 0 && slot.Car.Color == color {
 				result = append(result, *slot.Car)
 			}
 		}
+		lot.mu.RUnlock()
 	}
 	return result
 }
@@ -259,9 +904,10 @@ func (pm *ParkingManager) FindCarsByColor(color string) []Car {
 func (pm *ParkingManager) FindCars(filter CarFilter) []CarWithAttendant {
 	var result []CarWithAttendant
 
-	for _, lot := range pm.Lots {
+	for _, lot := range pm.lots() {
+		lot.mu.RLock()
 		for _, slot := range lot.Slots {
-			if slot.IsEmpty {
+			if slot.IsEmpty || slot.SpanHead != 0 {
 				continue
 			}
 			car := slot.Car
@@ -271,17 +917,15 @@ func (pm *ParkingManager) FindCars(filter CarFilter) []CarWithAttendant {
 			if filter.Make != "" && car.Make != filter.Make {
 				continue
 			}
-			if filter.Size != "" && car.Size != filter.Size {
+			if filter.Size != "" && car.Size.Class() != filter.Size.Class() {
 				continue
 			}
 			if filter.IsHandicap != nil && car.IsHandicap != *filter.IsHandicap {
 				continue
 			}
-			result = append(result, CarWithAttendant{
-				Car:       *car,
-				Attendant: slot.AttendantName,
-			})
+			result = append(result, lot.parkedCar(slot))
 		}
+		lot.mu.RUnlock()
 	}
 
 	return result
@@ -289,61 +933,98 @@ func (pm *ParkingManager) FindCars(filter CarFilter) []CarWithAttendant {
 
 func (pm *ParkingManager) FindCarsParkedWithin(duration time.Duration) []CarWithAttendant {
 	var result []CarWithAttendant
-	cutoff := time.Now().Add(-duration)
+	cutoff := pm.now().Add(-duration)
 
-	for _, lot := range pm.Lots {
+	for _, lot := range pm.lots() {
+		lot.mu.RLock()
 		for _, slot := range lot.Slots {
-			if !slot.IsEmpty && slot.Car.ParkedAt.After(cutoff) {
-				result = append(result, CarWithAttendant{
-					Car:       *slot.Car,
-					Attendant: slot.AttendantName,
-				})
+			if !slot.IsEmpty && slot.SpanHead == 0 && slot.Car.ParkedAt.After(cutoff) {
+				result = append(result, lot.parkedCar(slot))
 			}
 		}
+		lot.mu.RUnlock()
 	}
 	return result
 }
 
 func (pm *ParkingManager) FindSmallHandicapInRowBOrD() []CarWithAttendant {
 	var result []CarWithAttendant
-	for _, lot := range pm.Lots {
+	for _, lot := range pm.lots() {
+		lot.mu.RLock()
 		for _, slot := range lot.Slots {
-			if !slot.IsEmpty && slot.Car.Size == "small" && slot.Car.IsHandicap &&
+			if !slot.IsEmpty && slot.SpanHead == 0 && slot.Car.Size.Class() == SizeCompact && slot.Car.IsHandicap &&
 				(slot.Row == "B" || slot.Row == "D") {
-				result = append(result, CarWithAttendant{
-					Car:       *slot.Car,
-					Attendant: slot.AttendantName,
-					Row:       slot.Row,
-				})
+				result = append(result, lot.parkedCar(slot))
 			}
 		}
+		lot.mu.RUnlock()
 	}
 	return result
 }
 
 func (pl *ParkingLot) GetAllParkedCars() []CarWithAttendant {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
 	var result []CarWithAttendant
 	for _, slot := range pl.Slots {
-		if !slot.IsEmpty {
-			result = append(result, CarWithAttendant{
-				Car:       *slot.Car,
-				Attendant: slot.AttendantName,
-				Row:       slot.Row,
-			})
+		if !slot.IsEmpty && slot.SpanHead == 0 {
+			result = append(result, pl.parkedCar(slot))
 		}
 	}
 	return result
 }
 
 func main() {
-	manager := &ParkingManager{
-		Lots: []*ParkingLot{
-			NewParkingLot("Lot A", 5),
-			NewParkingLot("Lot B", 5),
-		},
+	dataDir := flag.String("data", "parkinglot-data", "directory where lot state is saved")
+	configPath := flag.String("config", "", "JSON file describing the lots; see Config")
+	httpAddr := flag.String("http", "", "serve the JSON API on this address instead of the menu, e.g. :8080")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		os.Exit(runCLI(*dataDir, *configPath, flag.Args(), os.Stdout, os.Stderr))
+	}
+
+	st, err := openState(*dataDir, *configPath)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	defer st.close()
+	manager := st.manager
+	if len(manager.Lots) == 0 {
+		for _, lot := range []*ParkingLot{NewParkingLot("Lot A", 5), NewParkingLot("Lot B", 5)} {
+			if err := st.addLot(lot); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if *httpAddr != "" {
+		go func() {
+			for range time.Tick(time.Minute) {
+				for _, lot := range manager.lots() {
+					if err := lot.SweepReservations(); err != nil {
+						fmt.Println("Error:", err)
+					}
+				}
+			}
+		}()
+		fmt.Println("Serving parking API on", *httpAddr)
+		server := NewServer(manager)
+		server.Journal = filepath.Join(st.dataDir, "journal.jsonl")
+		if err := http.ListenAndServe(*httpAddr, server); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	attendant := &Attendant{Name: "Admin", Lot: manager.Lots[0]}
+	if configured := st.attendants[manager.Lots[0].Name]; len(configured) > 0 {
+		attendant = configured[0]
+	}
 
 	for {
 		fmt.Println("\n--- Parking Lot System ---")
@@ -370,17 +1051,28 @@ func main() {
 			fmt.Scanln(&color)
 			fmt.Print("Enter Make: ")
 			fmt.Scanln(&make)
-			fmt.Print("Enter Size (small/large): ")
+			fmt.Print("Enter Size (motorcycle/compact/regular/large/bus): ")
 			fmt.Scanln(&size)
 			fmt.Print("Is Handicap? (true/false): ")
 			fmt.Scanln(&isHandicap)
 
-			car := &Car{Number: num, Color: color, Make: make, Size: size, IsHandicap: isHandicap}
+			vehicleSize, err := ParseVehicleSize(size)
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			car := &Car{Number: num, Color: color, Make: make, Size: vehicleSize, IsHandicap: isHandicap}
 			slot, err := attendant.ParkCarForDriver(car)
 			if err != nil {
 				fmt.Println("Error:", err)
 			} else {
 				fmt.Printf("Car parked at slot %d\n", slot)
+				if ticket, err := attendant.Lot.TicketFor(num); err == nil {
+					fmt.Printf("Ticket: %s\n", ticket.ID)
+				}
+				if car.Pass != "" {
+					fmt.Printf("Monthly pass %s recognized\n", car.Pass)
+				}
 			}
 
 		case 2:
@@ -402,7 +1094,7 @@ func main() {
 			if err != nil {
 				fmt.Println("Error:", err)
 			} else {
-				fmt.Printf("Car is parked at slot %d (Row %s)\n", slot.Number, slot.Row)
+				fmt.Printf("Car is parked at %s\n", slot.Location())
 			}
 
 		case 4:
@@ -428,18 +1120,22 @@ func main() {
 			var num string
 			fmt.Print("Enter Car Number: ")
 			fmt.Scanln(&num)
-			slot, fee, err := manager.Lots[0].UnparkCarAndCharge(num)
+			slot, quote, err := manager.Lots[0].UnparkCarWithQuote(num)
 			if err != nil {
 				fmt.Println("Error:", err)
 			} else {
-				fmt.Printf("Unparked from slot %d. Fee: ₹%d\n", slot, fee)
+				fmt.Printf("Unparked from slot %d.\n", slot)
+				for _, line := range quote.Lines {
+					fmt.Printf("  %-30s %s\n", line.Description, line.Amount)
+				}
+				fmt.Printf("Fee: %s\n", quote.Total)
 			}
 
 		case 7:
 			cars := manager.Lots[0].GetAllParkedCars()
 			fmt.Printf("Cars in Lot A:\n")
 			for _, c := range cars {
-				fmt.Printf(" - %s (%s) parked by %s at Row %s\n", c.Number, c.Make, c.Attendant, c.Row)
+				fmt.Printf(" - %s (%s) parked by %s at %s\n", c.Number, c.Make, c.Attendant, c.Location())
 			}
 
 		case 8:
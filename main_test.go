@@ -2,6 +2,8 @@
 package main
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
@@ -77,6 +79,7 @@ func TestNotifyObserversOnFull(t *testing.T) {
 	car2 := &Car{Number: "B"}
 	_, _ = lot.ParkCarWithNotification(car1)
 	_, _ = lot.ParkCarWithNotification(car2)
+	lot.flushObservers()
 
 	if !called {
 		t.Error("expected observer to be called on full lot")
@@ -98,6 +101,7 @@ func TestNotifyObserversOnAvailable(t *testing.T) {
 
 	// Now unpark, should trigger "AVAILABLE"
 	_, _ = lot.UnparkCarWithNotification("KA01XX0001")
+	lot.flushObservers()
 
 	if !called {
 		t.Error("expected observer to be called with AVAILABLE")
@@ -378,3 +382,93 @@ func TestGetAllParkedCarsInLot(t *testing.T) {
 		t.Errorf("unexpected car numbers: %+v", parkedCars)
 	}
 }
+
+func TestConcurrentParkNeverDoubleAssignsSlot(t *testing.T) {
+	const gates, carsPerGate = 8, 50
+	lot := NewParkingLot("Lot A", gates*carsPerGate)
+
+	var wg sync.WaitGroup
+	slotsTaken := make(chan int, gates*carsPerGate)
+	for g := 0; g < gates; g++ {
+		wg.Add(1)
+		go func(gate int) {
+			defer wg.Done()
+			for i := 0; i < carsPerGate; i++ {
+				car := &Car{Number: fmt.Sprintf("G%d-%d", gate, i)}
+				slot, err := lot.ParkCar(car)
+				if err != nil {
+					t.Errorf("gate %d failed to park: %v", gate, err)
+					return
+				}
+				slotsTaken <- slot
+			}
+		}(g)
+	}
+	// Readers run alongside the gates so -race also covers the query paths.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = lot.IsFull()
+			_ = lot.GetAllParkedCars()
+			_, _ = lot.FindCar("G0-0")
+		}
+	}()
+	wg.Wait()
+	close(slotsTaken)
+
+	seen := make(map[int]bool)
+	for slot := range slotsTaken {
+		if seen[slot] {
+			t.Fatalf("slot %d was assigned twice", slot)
+		}
+		seen[slot] = true
+	}
+	if len(seen) != gates*carsPerGate {
+		t.Errorf("expected %d distinct slots, got %d", gates*carsPerGate, len(seen))
+	}
+	if !lot.IsFull() {
+		t.Error("expected lot to be full after all gates parked")
+	}
+}
+
+func TestConcurrentParkAndUnparkAcrossManager(t *testing.T) {
+	manager := &ParkingManager{Lots: []*ParkingLot{
+		NewParkingLot("Lot A", 20),
+		NewParkingLot("Lot B", 20),
+	}}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func(gate int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				plate := fmt.Sprintf("M%d-%d", gate, i)
+				lotName, _, err := manager.ParkEvenly(&Car{Number: plate, Color: "White"})
+				if err != nil {
+					continue
+				}
+				_ = manager.FindCarsByColor("White")
+				if i%2 == 0 {
+					for _, lot := range manager.Lots {
+						if lot.Name == lotName {
+							_, _, _ = lot.UnparkCarAndCharge(plate)
+						}
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for _, lot := range manager.Lots {
+		plates := make(map[string]bool)
+		for _, c := range lot.GetAllParkedCars() {
+			if plates[c.Number] {
+				t.Fatalf("car %s parked twice in %s", c.Number, lot.Name)
+			}
+			plates[c.Number] = true
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// money.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidMoney    = errors.New("invalid amount")
+	ErrMixedCurrencies = errors.New("amounts in different currencies")
+)
+
+// DefaultCurrency is what a Money without a Currency is in; lots quote in
+// it unless their Pricing says otherwise.
+const DefaultCurrency = "INR"
+
+// Money is an amount in minor units of its currency, e.g. paise. Every
+// supported currency has 100 minor units to the major one. An empty
+// Currency is DefaultCurrency, or takes the currency of what it is added to.
+type Money struct {
+	Amount   int64
+	Currency string `json:",omitempty"`
+}
+
+// Rupees is n whole units of the default currency, as tariffs price in.
+func Rupees(n int) Money { return Money{Amount: int64(n) * 100} }
+
+func Paise(n int64) Money { return Money{Amount: n} }
+
+// UnmarshalJSON also reads a bare number as whole units of the default
+// currency, as journals, receipts and requests carried fees before Money.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var units int64
+	if err := json.Unmarshal(data, &units); err == nil {
+		*m = Money{Amount: units * 100}
+		return nil
+	}
+	type plain Money
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+func (m Money) currency(other Money) string {
+	switch {
+	case m.Currency == "":
+		return other.Currency
+	case other.Currency == "" || other.Currency == m.Currency:
+		return m.Currency
+	}
+	panic(fmt.Sprintf("money: mixing %s and %s", m.Currency, other.Currency))
+}
+
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currency(other)}
+}
+
+func (m Money) Sub(other Money) Money { return m.Add(other.Neg()) }
+
+// addChecked is Add for amounts read back from a journal, where a lot may
+// have changed currency: mixing them is an error rather than a panic, and
+// an empty currency counts as DefaultCurrency unless the amount is zero.
+func (m Money) addChecked(other Money) (Money, error) {
+	if m.Amount != 0 && other.Amount != 0 && m.code() != other.code() {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrMixedCurrencies, m.code(), other.code())
+	}
+	sum := Money{Amount: m.Amount + other.Amount, Currency: m.Currency}
+	if m.Currency == "" || m.Amount == 0 && other.Amount != 0 {
+		sum.Currency = other.Currency
+	}
+	return sum, nil
+}
+
+func (m Money) code() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+func (m Money) Neg() Money { return Money{Amount: -m.Amount, Currency: m.Currency} }
+
+func (m Money) IsZero() bool { return m.Amount == 0 }
+
+// Percent is basisPoints hundredths of a percent of m (900 is 9%), rounded
+// half up to the minor unit.
+func (m Money) Percent(basisPoints int) Money {
+	return Money{Amount: divRound(m.Amount*int64(basisPoints), 10000, RoundHalfUp), Currency: m.Currency}
+}
+
+// Rupees is the amount rounded half up to whole major units, for the older
+// APIs that report fees as ints.
+func (m Money) Rupees() int { return int(divRound(m.Amount, 100, RoundHalfUp)) }
+
+func (m Money) String() string {
+	sign, units := "", m.Decimal()
+	if m.Amount < 0 {
+		sign, units = "-", units[1:]
+	}
+	switch m.Currency {
+	case "", DefaultCurrency:
+		return sign + "₹" + units
+	}
+	return sign + m.Currency + " " + units
+}
+
+// Decimal is the amount in major units without a currency, e.g. "-6.05".
+func (m Money) Decimal() string {
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// ParseMoney reads an amount in major units such as "12.50" or "12".
+func ParseMoney(s, currency string) (Money, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if strings.ContainsAny(s, "+-") { // "-0.50" would otherwise parse as 0.50
+		return Money{}, fmt.Errorf("%w %q: amounts cannot be signed", ErrInvalidMoney, s)
+	}
+	if len(frac) > 2 {
+		return Money{}, fmt.Errorf("%w %q: at most two decimals", ErrInvalidMoney, s)
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units < 0 || units > math.MaxInt64/100-1 {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidMoney, s)
+	}
+	minor := int64(0)
+	if frac != "" {
+		if minor, err = strconv.ParseInt((frac + "0")[:2], 10, 64); err != nil || minor < 0 {
+			return Money{}, fmt.Errorf("%w %q", ErrInvalidMoney, s)
+		}
+	}
+	return Money{Amount: units*100 + minor, Currency: currency}, nil
+}
+
+type RoundingMode string
+
+const (
+	RoundHalfUp RoundingMode = "half_up" // the default; halves round away from zero
+	RoundUp     RoundingMode = "up"      // away from zero
+	RoundDown   RoundingMode = "down"    // towards zero
+)
+
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	switch m := RoundingMode(strings.ToLower(s)); m {
+	case "":
+		return RoundHalfUp, nil
+	case RoundHalfUp, RoundUp, RoundDown:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown rounding mode %q: want half_up, up or down", s)
+}
+
+// Rounding rounds fee totals to a multiple of Unit minor units, e.g. 100
+// for whole rupees at a cash-only gate. Unit 0 or 1 keeps every paisa.
+type Rounding struct {
+	Unit int64
+	Mode RoundingMode
+}
+
+func (r Rounding) Round(m Money) Money {
+	if r.Unit <= 1 {
+		return m
+	}
+	return Money{Amount: divRound(m.Amount, r.Unit, r.Mode) * r.Unit, Currency: m.Currency}
+}
+
+// divRound divides n by a positive d, rounding as mode says.
+func divRound(n, d int64, mode RoundingMode) int64 {
+	q, rem := n/d, n%d
+	if rem == 0 {
+		return q
+	}
+	away := int64(1)
+	if n < 0 {
+		away, rem = -1, -rem
+	}
+	switch mode {
+	case RoundUp:
+		return q + away
+	case RoundDown:
+		return q
+	}
+	if 2*rem >= d {
+		return q + away
+	}
+	return q
+}
+
+// TaxRate is a tax charged on the fee, e.g. {"CGST", 900} for 9%.
+type TaxRate struct {
+	Name        string
+	BasisPoints int // hundredths of a percent
+}
+
+// Pricing is what a lot adds on top of its tariff's quote: the currency,
+// the taxes and how the total is rounded. The zero value quotes in
+// DefaultCurrency, untaxed, to the paisa.
+type Pricing struct {
+	Currency string
+	Taxes    []TaxRate
+	Rounding Rounding
+}
+
+func (pl *ParkingLot) SetPricing(pricing Pricing) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.Pricing = pricing
+}
+
+// price finishes a quote: every line in the lot's currency, each tax on
+// the taxable amount (base and penalties less discounts), and a rounding
+// line if the total had to be rounded.
+func (p Pricing) price(q *FeeQuote) {
+	q.Total = Money{Currency: p.Currency}
+	for i := range q.Lines {
+		q.Lines[i].Amount.Currency = p.Currency
+		q.Total = q.Total.Add(q.Lines[i].Amount)
+	}
+
+	taxable := q.Total
+	if taxable.Amount > 0 {
+		for _, tax := range p.Taxes {
+			q.add(LineTax, fmt.Sprintf("%s %s%%", tax.Name, percentString(tax.BasisPoints)), taxable.Percent(tax.BasisPoints))
+		}
+	}
+	if rounded := p.Rounding.Round(q.Total); rounded != q.Total {
+		q.add(LineRounding, "Rounding", rounded.Sub(q.Total))
+	}
+	q.Breakdown = q.breakdown()
+}
+
+func percentString(basisPoints int) string {
+	s := strconv.FormatFloat(float64(basisPoints)/100, 'f', 2, 64)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
@@ -0,0 +1,88 @@
+// money_test.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMoneyRoundingAndParsing(t *testing.T) {
+	for _, tc := range []struct {
+		rounding Rounding
+		in, want int64
+	}{
+		{Rounding{}, 12345, 12345},
+		{Rounding{Unit: 100}, 12350, 12400},
+		{Rounding{Unit: 100}, 12349, 12300},
+		{Rounding{Unit: 100, Mode: RoundUp}, 12301, 12400},
+		{Rounding{Unit: 100, Mode: RoundDown}, 12399, 12300},
+		{Rounding{Unit: 50}, -1225, -1250},
+	} {
+		if got := tc.rounding.Round(Paise(tc.in)); got.Amount != tc.want {
+			t.Errorf("%+v rounding %d: got %d, want %d", tc.rounding, tc.in, got.Amount, tc.want)
+		}
+	}
+
+	if m, err := ParseMoney("12.5", "USD"); err != nil || m != (Money{Amount: 1250, Currency: "USD"}) || m.String() != "USD 12.50" {
+		t.Errorf("unexpected %+v (err %v)", m, err)
+	}
+	for _, bad := range []string{"", "-1", "-0.50", " -0.5", "+1", "1.+5", "1.234", "1.-5", "ten"} {
+		if _, err := ParseMoney(bad, ""); !errors.Is(err, ErrInvalidMoney) {
+			t.Errorf("expected %q to be refused, got %v", bad, err)
+		}
+	}
+	if s := Paise(-605).String(); s != "-₹6.05" {
+		t.Errorf("unexpected %q", s)
+	}
+
+	// Fees journaled before Money were whole rupees.
+	var entry JournalEntry
+	if err := json.Unmarshal([]byte(`{"Kind": "charged", "Fee": 6}`), &entry); err != nil || entry.Fee != Rupees(6) {
+		t.Errorf("expected a bare fee read as rupees, got %+v (err %v)", entry.Fee, err)
+	}
+}
+
+func TestPricingAddsTaxesAndRounding(t *testing.T) {
+	lot, clock := paidLot(t, nil)
+	lot.SetTariff(PerMinuteTariff{RatePerMinute: 2, MinimumMinutes: 1, LostTicket: 100})
+	lot.SetPricing(Pricing{
+		Taxes:    []TaxRate{{Name: "CGST", BasisPoints: 900}, {Name: "SGST", BasisPoints: 900}},
+		Rounding: Rounding{Unit: 100},
+	})
+	lot.ParkCar(&Car{Number: "GS1"})
+	clock.Advance(7 * time.Minute)
+
+	quote, err := lot.QuoteFee("GS1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ₹14 + 9% + 9% = ₹16.52, rounded to ₹17.
+	b := quote.Breakdown
+	if b.Base != Rupees(14) || b.Tax != Paise(252) || b.Rounding != Paise(48) || quote.Total != Rupees(17) || b.Total != quote.Total {
+		t.Errorf("unexpected breakdown %+v of %+v", b, quote.Lines)
+	}
+	if tax := quote.Lines[1]; tax.Kind != LineTax || tax.Description != "CGST 9%" || tax.Amount != Paise(126) {
+		t.Errorf("unexpected tax line %+v", tax)
+	}
+
+	receipt, err := lot.PayAndUnpark(ExitPayment{Plate: "GS1", Lost: true, Method: PayCash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The penalty is taxed too: (14 + 100) * 1.18 = 134.52.
+	if b := receipt.Quote.Breakdown; b.Penalties != Rupees(100) || b.Tax != Paise(2052) || receipt.Payment.Amount != Rupees(135) {
+		t.Errorf("unexpected receipt %+v paid %s", b, receipt.Payment.Amount)
+	}
+}
+
+func TestProRataTariffBillsBySecond(t *testing.T) {
+	tariff := PerMinuteTariff{RatePerMinute: 2, MinimumMinutes: 1, ProRata: true}
+	if q := tariff.Quote(Car{}, monday10am, monday10am.Add(2*time.Minute+15*time.Second)); q.Total != Paise(450) {
+		t.Errorf("expected ₹4.50 for 2m15s, got %s", q.Total)
+	}
+	if q := tariff.Quote(Car{}, monday10am, monday10am.Add(20*time.Second)); q.Total != Rupees(2) {
+		t.Errorf("expected the minimum minute, got %s", q.Total)
+	}
+}
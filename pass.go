@@ -0,0 +1,408 @@
+// pass.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidPass = errors.New("invalid pass")
+	ErrUnknownPass = errors.New("no pass for plate")
+)
+
+// Pass is a subscriber's monthly pass. A car parked while its pass covers
+// the lot is billed with Discount percent off the parking fee; Discount
+// 100 parks free.
+type Pass struct {
+	ID       string
+	Plate    string
+	Holder   string    `json:",omitempty"`
+	From     time.Time // valid from From up to, not including, Until
+	Until    time.Time
+	Lots     []string `json:",omitempty"` // lots the pass covers; empty covers every lot
+	Slot     int      `json:",omitempty"` // dedicated slot in the pass's only lot, kept free for the holder
+	Discount int
+}
+
+// Covers reports whether the pass is valid in the lot at the given time.
+func (p Pass) Covers(lot string, at time.Time) bool {
+	if at.Before(p.From) || !at.Before(p.Until) {
+		return false
+	}
+	return len(p.Lots) == 0 || slices.Contains(p.Lots, lot)
+}
+
+func (p Pass) validate() error {
+	switch {
+	case p.Plate == "":
+		return fmt.Errorf("%w: no plate", ErrInvalidPass)
+	case !p.Until.After(p.From):
+		return fmt.Errorf("%w: it must end after it starts", ErrInvalidPass)
+	case p.Discount < 1 || p.Discount > 100:
+		return fmt.Errorf("%w: discount must be 1-100 percent", ErrInvalidPass)
+	case p.Slot < 0:
+		return fmt.Errorf("%w: bad slot %d", ErrInvalidPass, p.Slot)
+	case p.Slot > 0 && len(p.Lots) != 1:
+		return fmt.Errorf("%w: a dedicated slot needs exactly one lot", ErrInvalidPass)
+	case p.ID != "" && !isPassHold(p.ID): // the slot it holds would never be released
+		return fmt.Errorf("%w: pass IDs are issued by the registry and start with P-, got %q", ErrInvalidPass, p.ID)
+	}
+	return nil
+}
+
+// PassRegistry holds one pass per plate. With a Path every change is
+// written through to that file before it takes effect.
+type PassRegistry struct {
+	Path string // "" keeps the passes in memory only
+
+	mu      sync.RWMutex
+	passes  map[string]Pass
+	version uint64 // bumped on every change, so lots know to sweep again
+}
+
+func NewPassRegistry() *PassRegistry {
+	return &PassRegistry{passes: make(map[string]Pass)}
+}
+
+// LoadPasses reads the registry kept at path, one JSON pass per line. A
+// missing file is an empty registry.
+func LoadPasses(path string) (*PassRegistry, error) {
+	r := NewPassRegistry()
+	r.Path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var p Pass
+		if err := json.Unmarshal(sc.Bytes(), &p); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		r.passes[p.Plate] = p
+	}
+	return r, sc.Err()
+}
+
+// Add registers the pass, replacing any pass the plate already has. A
+// replacement keeps the old ID unless one is given, so a renewal also
+// covers the car parked under the old terms.
+func (r *PassRegistry) Add(p Pass) (Pass, error) {
+	if err := p.validate(); err != nil {
+		return Pass{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, had := r.passes[p.Plate]
+	if p.ID == "" {
+		p.ID = old.ID
+	}
+	if p.ID == "" {
+		p.ID = "P-" + newTicketID()[2:]
+	}
+	r.passes[p.Plate] = p
+	if err := r.saveLocked(); err != nil {
+		if had {
+			r.passes[p.Plate] = old
+		} else {
+			delete(r.passes, p.Plate)
+		}
+		return Pass{}, err
+	}
+	r.version++
+	return p, nil
+}
+
+func (r *PassRegistry) Remove(plate string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.passes[plate]
+	if !ok {
+		return &LotError{Plate: plate, Err: ErrUnknownPass}
+	}
+	delete(r.passes, plate)
+	if err := r.saveLocked(); err != nil {
+		r.passes[plate] = old
+		return err
+	}
+	r.version++
+	return nil
+}
+
+func (r *PassRegistry) changes() uint64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// Lookup returns the plate's pass. A nil registry has no passes.
+func (r *PassRegistry) Lookup(plate string) (Pass, bool) {
+	if r == nil {
+		return Pass{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.passes[plate]
+	return p, ok
+}
+
+// List returns the passes ordered by plate.
+func (r *PassRegistry) List() []Pass {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Pass, 0, len(r.passes))
+	for _, p := range r.passes {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Plate < list[j].Plate })
+	return list
+}
+
+func (r *PassRegistry) saveLocked() error {
+	if r.Path == "" {
+		return nil
+	}
+	plates := make([]string, 0, len(r.passes))
+	for plate := range r.passes {
+		plates = append(plates, plate)
+	}
+	sort.Strings(plates)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, plate := range plates {
+		if err := enc.Encode(r.passes[plate]); err != nil {
+			return err
+		}
+	}
+	if err := replaceFile(r.Path, buf.Bytes()); err != nil {
+		return fmt.Errorf("%w: %v", ErrPersist, err)
+	}
+	return nil
+}
+
+// SetPasses installs the registry the lot checks arriving plates against
+// and claims the dedicated slots of the passes it holds.
+func (pl *ParkingLot) SetPasses(passes *PassRegistry) {
+	pl.update(func() {
+		pl.Passes = passes
+		pl.sweepPassesLocked()
+	})
+}
+
+// passLocked returns the plate's pass if it covers the lot now.
+func (pl *ParkingLot) passLocked(plate string) (Pass, bool) {
+	p, ok := pl.Passes.Lookup(plate)
+	if !ok || !p.Covers(pl.Name, pl.now()) {
+		return Pass{}, false
+	}
+	return p, true
+}
+
+func isPassHold(id string) bool { return strings.HasPrefix(id, "P-") }
+
+// passSweep records what the lot's dedicated slots were last swept
+// against: the registry, its version and the next time a dedicated pass
+// starts or lapses. Until one of them changes a sweep has nothing to do.
+type passSweep struct {
+	registry *PassRegistry
+	version  uint64
+	until    time.Time      // zero when no dedicated pass starts or lapses later
+	slots    map[int]string // dedicated slot number to the ID of its pass
+}
+
+// sweepPassesLocked holds each valid pass's dedicated slot in this lot
+// while it is empty, and lets go of slots whose pass has lapsed, moved or
+// been removed. It only walks the slots when the passes or their validity
+// have changed since the last sweep; in between, releaseLocked holds a
+// dedicated slot again as its car leaves.
+func (pl *ParkingLot) sweepPassesLocked() {
+	now := pl.now()
+	sw := &pl.passSweep
+	version := pl.Passes.changes()
+	if sw.slots != nil && sw.registry == pl.Passes && sw.version == version && (sw.until.IsZero() || now.Before(sw.until)) {
+		return
+	}
+	*sw = passSweep{registry: pl.Passes, version: version, slots: make(map[int]string)}
+	for _, p := range pl.Passes.List() {
+		if p.Slot == 0 || p.Lots[0] != pl.Name {
+			continue
+		}
+		next := p.From
+		if !now.Before(p.From) {
+			next = p.Until
+		}
+		if now.Before(next) && (sw.until.IsZero() || next.Before(sw.until)) {
+			sw.until = next
+		}
+		if p.Covers(pl.Name, now) {
+			sw.slots[p.Slot] = p.ID
+		}
+	}
+	for i := range pl.Slots {
+		slot := &pl.Slots[i]
+		switch {
+		case isPassHold(slot.HeldFor) && sw.slots[slot.Number] != slot.HeldFor:
+			pl.unholdSlotLocked(i)
+		case slot.open() && sw.slots[slot.Number] != "":
+			pl.holdSlotLocked(i, sw.slots[slot.Number])
+		}
+	}
+}
+
+// holdForPassLocked holds the slot at i again if it is empty and dedicated
+// to a valid pass, reporting whether it did.
+func (pl *ParkingLot) holdForPassLocked(i int) bool {
+	id := pl.passSweep.slots[pl.Slots[i].Number]
+	if id == "" || !pl.Slots[i].open() {
+		return false
+	}
+	pl.Slots[i].HeldFor = id
+	pl.indexLocked().markTaken(pl.Slots, i)
+	return true
+}
+
+// placeOnPassLocked parks a pass holder in the dedicated slot. It returns
+// -1 when the slot is taken or does not fit the car, and the car then goes
+// through normal placement.
+func (pl *ParkingLot) placeOnPassLocked(p Pass, car *Car, attendantName string) int {
+	i := pl.slotIndexLocked(p.Slot)
+	if i < 0 || !car.Size.FitsIn(pl.Slots[i].Size) {
+		return -1
+	}
+	switch pl.Slots[i].HeldFor {
+	case p.ID:
+		pl.unholdSlotLocked(i)
+	case "":
+		if !pl.Slots[i].IsEmpty {
+			return -1
+		}
+	default:
+		return -1
+	}
+	pl.occupyLocked(i, 1, car, attendantName)
+	return pl.Slots[i].Number
+}
+
+// discount takes the pass discount off the parking fee and says why.
+func (p Pass) discount(q *FeeQuote) {
+	off := q.Total.Percent(p.Discount * 100)
+	q.add(LineDiscount, fmt.Sprintf("Monthly pass %s valid to %s: %d%% off", p.ID, p.Until.Format("2006-01-02"), p.Discount), off.Neg())
+}
+
+// HasDedicatedSlot reports whether the plate holds a valid pass with a
+// slot kept for it in this lot.
+func (pl *ParkingLot) HasDedicatedSlot(plate string) bool {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	p, ok := pl.passLocked(plate)
+	return ok && p.Slot != 0
+}
+
+// SetPasses installs the registry on the manager and every lot it manages;
+// lots added later get it too.
+func (pm *ParkingManager) SetPasses(passes *PassRegistry) {
+	pm.mu.Lock()
+	pm.setPassesLocked(passes)
+	pm.mu.Unlock()
+	pm.sweepPasses()
+}
+
+func (pm *ParkingManager) setPassesLocked(passes *PassRegistry) {
+	pm.Passes = passes
+	for _, lot := range pm.Lots {
+		lot.mu.Lock()
+		lot.Passes = passes
+		lot.mu.Unlock()
+	}
+}
+
+// AddPass registers a pass after checking its lots and dedicated slot
+// exist, then lets the lots claim or release dedicated slots.
+func (pm *ParkingManager) AddPass(p Pass) (Pass, error) {
+	if err := p.validate(); err != nil {
+		return Pass{}, &LotError{Plate: p.Plate, Err: err}
+	}
+	for _, name := range p.Lots {
+		lot, err := pm.Lot(name)
+		if err != nil {
+			return Pass{}, err
+		}
+		if p.Slot != 0 && !lot.hasSlot(p.Slot) {
+			return Pass{}, &LotError{Lot: name, Plate: p.Plate, Err: fmt.Errorf("%w %d", ErrUnknownSlot, p.Slot)}
+		}
+	}
+	passes := pm.passes()
+	if p.Slot != 0 {
+		for _, other := range passes.List() {
+			if other.Plate != p.Plate && other.Slot == p.Slot && slices.Equal(other.Lots, p.Lots) &&
+				other.From.Before(p.Until) && p.From.Before(other.Until) {
+				return Pass{}, &LotError{Lot: p.Lots[0], Plate: p.Plate,
+					Err: fmt.Errorf("%w: slot %d is dedicated to %s", ErrInvalidPass, p.Slot, other.Plate)}
+			}
+		}
+	}
+	p, err := passes.Add(p)
+	if err != nil {
+		return Pass{}, &LotError{Plate: p.Plate, Err: err}
+	}
+	pm.sweepPasses()
+	return p, nil
+}
+
+func (pm *ParkingManager) RemovePass(plate string) error {
+	if err := pm.passes().Remove(plate); err != nil {
+		return err
+	}
+	pm.sweepPasses()
+	return nil
+}
+
+// ListPasses lists the registered passes.
+func (pm *ParkingManager) ListPasses() []Pass {
+	return pm.passes().List()
+}
+
+// passes returns the manager's registry, installing an in-memory one on
+// first use.
+func (pm *ParkingManager) passes() *PassRegistry {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.Passes == nil {
+		pm.setPassesLocked(NewPassRegistry())
+	}
+	return pm.Passes
+}
+
+func (pm *ParkingManager) sweepPasses() {
+	for _, lot := range pm.lots() {
+		lot.update(func() { lot.sweepPassesLocked() })
+	}
+}
+
+func (pl *ParkingLot) hasSlot(number int) bool {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	return pl.slotIndexLocked(number) >= 0
+}
@@ -0,0 +1,212 @@
+// pass_test.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func passManager(t *testing.T, lots ...*ParkingLot) (*ParkingManager, *FakeClock) {
+	t.Helper()
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	manager := NewParkingManager(lots...)
+	manager.SetClock(clock)
+	return manager, clock
+}
+
+func march() (time.Time, time.Time) {
+	return time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestPassHolderParksFreeInCoveredLot(t *testing.T) {
+	manager, clock := passManager(t, NewParkingLot("Big", 5), NewParkingLot("Small", 2))
+	from, until := march()
+	p, err := manager.AddPass(Pass{Plate: "MP1", From: from, Until: until, Lots: []string{"Small"}, Discount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lotName, _, err := manager.ParkEvenly(&Car{Number: "MP1"})
+	if err != nil || lotName != "Small" {
+		t.Fatalf("expected the pass holder in the covered lot, got %q (err %v)", lotName, err)
+	}
+	lot, _ := manager.Lot("Small")
+	clock.Advance(3 * time.Hour)
+	_, quote, err := lot.UnparkCarWithQuote("MP1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := quote.Lines[len(quote.Lines)-1]
+	if !quote.Total.IsZero() || !strings.Contains(last.Description, p.ID) || last.Amount != Rupees(-360) {
+		t.Errorf("expected the pass to waive the fee and say so, got %+v", quote)
+	}
+
+	// Outside the covered lot the holder pays in full.
+	big, _ := manager.Lot("Big")
+	big.ParkCar(&Car{Number: "MP1"})
+	clock.Advance(10 * time.Minute)
+	if _, fee, _ := big.UnparkCarAndCharge("MP1"); fee != 20 {
+		t.Errorf("expected the full fee outside the pass's lots, got %d", fee)
+	}
+}
+
+func TestPassDiscountAndValidity(t *testing.T) {
+	lot := NewParkingLot("Lot A", 3)
+	manager, clock := passManager(t, lot)
+	from, until := march()
+	if _, err := manager.AddPass(Pass{Plate: "MP2", From: from, Until: until, Discount: 25}); err != nil {
+		t.Fatal(err)
+	}
+	lot.ParkCar(&Car{Number: "MP2"})
+	clock.Advance(time.Hour)
+	if _, fee, _ := lot.UnparkCarAndCharge("MP2"); fee != 90 {
+		t.Errorf("expected 25%% off ₹120, got %d", fee)
+	}
+
+	clock.Set(until)
+	lot.ParkCar(&Car{Number: "MP2"})
+	if car, _ := lot.FindCar("MP2"); car.Car.Pass != "" {
+		t.Errorf("expected a lapsed pass not to be recognized, got %q", car.Car.Pass)
+	}
+	clock.Advance(time.Hour)
+	if _, fee, _ := lot.UnparkCarAndCharge("MP2"); fee != 120 {
+		t.Errorf("expected the full fee after the pass lapsed, got %d", fee)
+	}
+
+	for _, bad := range []Pass{
+		{Plate: "", From: from, Until: until, Discount: 100},
+		{Plate: "X", From: until, Until: from, Discount: 100},
+		{Plate: "X", From: from, Until: until, Discount: 0},
+		{Plate: "X", From: from, Until: until, Discount: 100, Slot: 1},
+		{Plate: "X", From: from, Until: until, Discount: 100, ID: "CUSTOM-1"},
+	} {
+		if _, err := manager.AddPass(bad); !errors.Is(err, ErrInvalidPass) {
+			t.Errorf("expected %+v to be refused, got %v", bad, err)
+		}
+	}
+	if _, err := manager.AddPass(Pass{Plate: "X", From: from, Until: until, Discount: 100, Lots: []string{"Lot A"}, Slot: 9}); !errors.Is(err, ErrUnknownSlot) {
+		t.Errorf("expected an unknown dedicated slot, got %v", err)
+	}
+}
+
+func TestPassDedicatedSlotIsKeptForHolder(t *testing.T) {
+	lot := NewParkingLot("Lot A", 2)
+	manager, _ := passManager(t, lot)
+	from, until := march()
+	p := Pass{Plate: "MP3", From: from, Until: until, Lots: []string{"Lot A"}, Slot: 1, Discount: 100}
+	if _, err := manager.AddPass(p); err != nil {
+		t.Fatal(err)
+	}
+	other := p
+	other.Plate = "MP4"
+	if _, err := manager.AddPass(other); !errors.Is(err, ErrInvalidPass) {
+		t.Errorf("expected a second pass for the same slot to be refused, got %v", err)
+	}
+
+	if slot, _ := lot.ParkCar(&Car{Number: "W1"}); slot != 2 {
+		t.Errorf("expected the walk-in kept out of the dedicated slot, got slot %d", slot)
+	}
+	if _, err := lot.ParkCar(&Car{Number: "W2"}); !errors.Is(err, ErrLotFull) {
+		t.Errorf("expected the lot to count as full, got %v", err)
+	}
+	if slot, err := lot.ParkCar(&Car{Number: "MP3"}); err != nil || slot != 1 {
+		t.Fatalf("expected the holder in slot 1, got %d (err %v)", slot, err)
+	}
+	lot.UnparkCar("MP3")
+	if _, err := lot.ParkCar(&Car{Number: "W2"}); !errors.Is(err, ErrLotFull) {
+		t.Errorf("expected the slot held again once the holder left, got %v", err)
+	}
+
+	if err := manager.RemovePass("MP3"); err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := lot.ParkCar(&Car{Number: "W2"}); err != nil || slot != 1 {
+		t.Errorf("expected the slot released with the pass, got %d (err %v)", slot, err)
+	}
+	if err := manager.RemovePass("MP3"); !errors.Is(err, ErrUnknownPass) {
+		t.Errorf("expected no pass left, got %v", err)
+	}
+}
+
+func TestPassDedicatedSlotFollowsPassWindow(t *testing.T) {
+	lot := NewParkingLot("Lot A", 2)
+	manager, clock := passManager(t, lot)
+	if _, err := lot.ParkCar(&Car{Number: "W1"}); err != nil { // in slot 1 before the pass
+		t.Fatal(err)
+	}
+	from := clock.Now().Add(time.Hour)
+	p := Pass{Plate: "MP5", From: from, Until: from.Add(time.Hour), Lots: []string{"Lot A"}, Slot: 1, Discount: 100}
+	if _, err := manager.AddPass(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// Before the pass starts the slot is anyone's.
+	lot.UnparkCar("W1")
+	if slot, err := lot.ParkCar(&Car{Number: "W2"}); err != nil || slot != 1 {
+		t.Fatalf("expected slot 1 open before the pass starts, got %d (err %v)", slot, err)
+	}
+	clock.Set(from)
+	lot.UnparkCar("W2")
+	if slot, err := lot.ParkCar(&Car{Number: "W3"}); err != nil || slot != 2 {
+		t.Errorf("expected slot 1 held once the pass started, got %d (err %v)", slot, err)
+	}
+	if _, err := lot.ParkCar(&Car{Number: "W4"}); !errors.Is(err, ErrLotFull) {
+		t.Errorf("expected the dedicated slot kept, got %v", err)
+	}
+
+	clock.Set(p.Until)
+	if slot, err := lot.ParkCar(&Car{Number: "W4"}); err != nil || slot != 1 {
+		t.Errorf("expected the slot released when the pass lapsed, got %d (err %v)", slot, err)
+	}
+}
+
+func TestPassRegistryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passes.jsonl")
+	passes, err := LoadPasses(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, until := march()
+	p, err := passes.Add(Pass{Plate: "MP5", Holder: "Meera", From: from, Until: until, Discount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := passes.Add(Pass{Plate: "MP5", From: until, Until: until.AddDate(0, 1, 0), Discount: 100})
+	if err != nil || renewed.ID != p.ID {
+		t.Fatalf("expected a renewal to keep ID %s, got %+v (err %v)", p.ID, renewed, err)
+	}
+
+	reloaded, err := LoadPasses(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := reloaded.Lookup("MP5"); !ok || !got.Until.Equal(renewed.Until) {
+		t.Errorf("expected the renewed pass after reloading, got %+v", got)
+	}
+}
+
+func TestCLIPasses(t *testing.T) {
+	dir := t.TempDir()
+	runCLITest(t, dir, exitOK, "lots", "create", "Lot A", "-slots", "2")
+	runCLITest(t, dir, exitOK, "passes", "add", "CP1", "-until", "2999-01-01", "-lots", "Lot A", "-slot", "2")
+	runCLITest(t, dir, exitUsage, "passes", "add", "CP2")
+	runCLITest(t, dir, exitNotFound, "passes", "remove", "CP2")
+
+	if out := runCLITest(t, dir, exitOK, "park", "CP1"); !strings.Contains(out, "slot 2") || !strings.Contains(out, "Monthly pass") {
+		t.Errorf("unexpected park output %q", out)
+	}
+	var charged exitResponse
+	out := runCLITest(t, dir, exitOK, "charge", "CP1", "-json")
+	if err := json.Unmarshal([]byte(out), &charged); err != nil || !charged.Fee.IsZero() {
+		t.Errorf("expected the pass holder to leave free, got %q", out)
+	}
+	var list []Pass
+	out = runCLITest(t, dir, exitOK, "passes", "-json")
+	if err := json.Unmarshal([]byte(out), &list); err != nil || len(list) != 1 || list[0].Slot != 2 {
+		t.Errorf("unexpected passes output %q", out)
+	}
+}
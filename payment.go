@@ -0,0 +1,424 @@
+// payment.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrPaymentDeclined = errors.New("payment declined")
+	ErrPaymentMethod   = errors.New("unsupported payment method")
+	ErrPaymentPending  = errors.New("payment in progress")
+	ErrNoReceipt       = errors.New("no receipt")
+	ErrRefundExceeds   = errors.New("refund exceeds the amount paid")
+)
+
+type PaymentMethod string
+
+const (
+	PayCash   PaymentMethod = "cash"
+	PayCard   PaymentMethod = "card"
+	PayUPI    PaymentMethod = "upi"
+	PayWallet PaymentMethod = "wallet"
+)
+
+var paymentMethods = []PaymentMethod{PayCash, PayCard, PayUPI, PayWallet}
+
+func ParsePaymentMethod(s string) (PaymentMethod, error) {
+	m := PaymentMethod(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(paymentMethods, m) {
+		return "", fmt.Errorf("%w %q: want cash, card, upi or wallet", ErrPaymentMethod, s)
+	}
+	return m, nil
+}
+
+type PaymentRequest struct {
+	Method PaymentMethod
+	Amount Money
+	Ticket string
+	Plate  string
+}
+
+// Payment is a completed charge; ID is the processor's transaction ID.
+type Payment struct {
+	ID     string
+	Method PaymentMethod
+	Amount Money
+}
+
+type Refund struct {
+	ID     string
+	Amount Money
+	Reason string `json:",omitempty"`
+	Time   time.Time
+
+	// Pending is set while the gateway is asked for the refund. One left
+	// pending was cut short and must be checked with the gateway; it still
+	// counts against what may be refunded.
+	Pending bool `json:",omitempty"`
+}
+
+// PaymentProcessor takes payments and gives money back. Pay either
+// succeeds in full or returns an error having taken nothing.
+type PaymentProcessor interface {
+	Pay(req PaymentRequest) (Payment, error)
+	Refund(payment Payment, amount Money) (Refund, error)
+}
+
+// DefaultPayments is used by lots without a processor: it takes cash only.
+var DefaultPayments PaymentProcessor = cashDrawer{}
+
+type cashDrawer struct{}
+
+func (cashDrawer) Pay(req PaymentRequest) (Payment, error) {
+	if req.Method != PayCash {
+		return Payment{}, fmt.Errorf("%w: only cash is taken here", ErrPaymentMethod)
+	}
+	return Payment{ID: "CASH-" + newTicketID()[2:], Method: PayCash, Amount: req.Amount}, nil
+}
+
+func (cashDrawer) Refund(p Payment, amount Money) (Refund, error) {
+	return Refund{ID: "CASH-" + newTicketID()[2:], Amount: amount}, nil
+}
+
+// MockGateway is an in-process PaymentProcessor standing in for a card,
+// UPI and wallet provider. It takes every method unless Declines names
+// it, and remembers what it took so tests can check.
+type MockGateway struct {
+	Declines map[PaymentMethod]bool
+
+	mu       sync.Mutex
+	payments []Payment
+	refunds  []Refund
+}
+
+// mockID is random like a ticket ID, so IDs from separate CLI runs do not
+// repeat.
+func mockID() string { return "MOCK-" + newTicketID()[2:] }
+
+func (g *MockGateway) Pay(req PaymentRequest) (Payment, error) {
+	if _, err := ParsePaymentMethod(string(req.Method)); err != nil {
+		return Payment{}, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Declines[req.Method] {
+		return Payment{}, fmt.Errorf("%w: %s refused %s for %s", ErrPaymentDeclined, req.Method, req.Amount, req.Plate)
+	}
+	p := Payment{ID: mockID(), Method: req.Method, Amount: req.Amount}
+	g.payments = append(g.payments, p)
+	return p, nil
+}
+
+func (g *MockGateway) Refund(p Payment, amount Money) (Refund, error) {
+	if amount.Amount > p.Amount.Amount {
+		return Refund{}, ErrRefundExceeds
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r := Refund{ID: mockID(), Amount: amount}
+	g.refunds = append(g.refunds, r)
+	return r, nil
+}
+
+func (g *MockGateway) Payments() []Payment {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Clone(g.payments)
+}
+
+// Receipt is the record of a paid exit, kept per ticket.
+type Receipt struct {
+	Lot     string
+	Ticket  Ticket
+	Quote   FeeQuote
+	Payment Payment
+	Refunds []Refund `json:",omitempty"`
+}
+
+func (r Receipt) Refunded() Money {
+	total := Money{Currency: r.Payment.Amount.Currency}
+	for _, refund := range r.Refunds {
+		total = total.Add(refund.Amount)
+	}
+	return total
+}
+
+// ReceiptStore is implemented by stores that keep receipts as well as
+// lots. Lots whose store does not keep receipts hold them in memory.
+type ReceiptStore interface {
+	SaveReceipt(r Receipt) error
+	LoadReceipt(ticketID string) (Receipt, error)
+	ReceiptsFor(plate string) ([]Receipt, error)
+}
+
+type memoryReceipts map[string]Receipt
+
+func (m memoryReceipts) SaveReceipt(r Receipt) error {
+	m[r.Ticket.ID] = r
+	return nil
+}
+
+func (m memoryReceipts) LoadReceipt(ticketID string) (Receipt, error) {
+	r, ok := m[ticketID]
+	if !ok {
+		return Receipt{}, fmt.Errorf("%w for ticket %s", ErrNoReceipt, ticketID)
+	}
+	return r, nil
+}
+
+func (m memoryReceipts) ReceiptsFor(plate string) ([]Receipt, error) {
+	var list []Receipt
+	for _, r := range m {
+		if r.Ticket.Plate == plate {
+			list = append(list, r)
+		}
+	}
+	slices.SortFunc(list, func(a, b Receipt) int { return a.Ticket.EntryTime.Compare(b.Ticket.EntryTime) })
+	return list, nil
+}
+
+// ExitPayment asks for a paid exit by plate, by ticket, or without a
+// ticket when Lost is set.
+type ExitPayment struct {
+	Plate  string
+	Ticket string // checked against Plate when both are given
+	Lost   bool
+	Method PaymentMethod
+}
+
+func (pl *ParkingLot) SetPayments(payments PaymentProcessor) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.Payments = payments
+}
+
+// PayAndUnpark is the two-phase exit. The stay is priced and the ticket
+// marked as checking out, then the processor is asked for the fee with
+// the lot unlocked; only once it has paid is the slot released, at the
+// quoted price. A declined payment leaves the car parked. If the release
+// fails after paying, the payment is refunded.
+func (pl *ParkingLot) PayAndUnpark(req ExitPayment) (Receipt, error) {
+	method, err := ParsePaymentMethod(string(req.Method))
+	if err != nil {
+		return Receipt{}, pl.errorf(req.Plate, err)
+	}
+	exit := exitRequest{plate: req.Plate, ticketID: req.Ticket, charge: true, lostTicket: req.Lost}
+	ticket, quote, payments, err := pl.beginCheckout(exit)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	payment := Payment{Method: method}
+	if quote.Total.Amount > 0 {
+		payment, err = payments.Pay(PaymentRequest{Method: method, Amount: quote.Total, Ticket: ticket.ID, Plate: ticket.Plate})
+	}
+	if err != nil {
+		pl.update(func() {
+			delete(pl.checkouts, ticket.ID)
+			e := Event{Kind: EventPaymentFailed, Plate: ticket.Plate, Slot: ticket.Slot, Ticket: ticket.ID, Fee: quote.Total, Reason: err.Error()}
+			pl.queueLocked(e)
+		})
+		return Receipt{}, pl.errorf(ticket.Plate, err)
+	}
+
+	exit = exitRequest{ticketID: ticket.ID, charge: true, lostTicket: req.Lost, quote: &quote, payment: &payment}
+	paid, quote, err := pl.unpark(exit)
+	if err != nil {
+		pl.update(func() { delete(pl.checkouts, ticket.ID) })
+		if payment.Amount.Amount > 0 {
+			if _, rerr := payments.Refund(payment, payment.Amount); rerr != nil {
+				err = fmt.Errorf("%w; refunding %s failed: %v", err, payment.ID, rerr)
+			}
+		}
+		return Receipt{}, err
+	}
+
+	ticket = paid
+	receipt := Receipt{Lot: pl.Name, Ticket: ticket, Quote: quote, Payment: payment}
+	pl.mu.Lock()
+	err = pl.saveReceiptLocked(receipt)
+	pl.mu.Unlock()
+	if err != nil {
+		return receipt, pl.errorf(ticket.Plate, fmt.Errorf("%w: receipt: %v", ErrPersist, err))
+	}
+	return receipt, nil
+}
+
+// beginCheckout is the first phase of PayAndUnpark: it prices the stay as
+// of now and keeps other exits away from the ticket until payment ends.
+func (pl *ParkingLot) beginCheckout(req exitRequest) (ticket Ticket, quote FeeQuote, payments PaymentProcessor, err error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	i, err := pl.exitSlotLocked(req)
+	if err != nil {
+		return Ticket{}, FeeQuote{}, nil, err
+	}
+	ticket = pl.ticketLocked(i)
+	car := *pl.Slots[i].Car
+	quote = pl.quoteLocked(car, req.lostTicket)
+	if pl.checkouts == nil {
+		pl.checkouts = make(map[string]bool)
+	}
+	pl.checkouts[ticket.ID] = true
+	payments = pl.Payments
+	if payments == nil {
+		payments = DefaultPayments
+	}
+	return ticket, quote, payments, nil
+}
+
+// RefundTicket gives back part or, with amount 0, the rest of what was
+// paid for the ticket and records the refund on its receipt.
+func (pl *ParkingLot) RefundTicket(ticketID string, amount Money, reason string) (Receipt, error) {
+	pl.refundMu.Lock() // one refund at a time, so two cannot both pass the balance check
+	defer pl.refundMu.Unlock()
+
+	pl.mu.RLock()
+	receipt, err := pl.receiptsLocked().LoadReceipt(ticketID)
+	payments := pl.Payments
+	pl.mu.RUnlock()
+	if err != nil {
+		return Receipt{}, &LotError{Lot: pl.Name, Err: err}
+	}
+	if payments == nil {
+		payments = DefaultPayments
+	}
+	left := receipt.Payment.Amount.Sub(receipt.Refunded())
+	if amount.IsZero() {
+		amount = left
+	}
+	switch {
+	case amount.Amount < 0:
+		return Receipt{}, pl.errorf(receipt.Ticket.Plate, badRequest("refund amount must be positive"))
+	case amount.Amount == 0 || amount.Amount > left.Amount:
+		return Receipt{}, pl.errorf(receipt.Ticket.Plate, fmt.Errorf("%w: %s of %s is left", ErrRefundExceeds, left, receipt.Payment.Amount))
+	}
+	amount.Currency = left.Currency
+
+	// The refund is saved as pending before the gateway is asked, so money
+	// is never given back without the receipt showing it.
+	last := len(receipt.Refunds)
+	pl.mu.Lock()
+	receipt.Refunds = append(receipt.Refunds, Refund{Amount: amount, Reason: reason, Time: pl.now(), Pending: true})
+	err = pl.saveReceiptLocked(receipt)
+	pl.mu.Unlock()
+	if err != nil {
+		return Receipt{}, pl.errorf(receipt.Ticket.Plate, fmt.Errorf("%w: receipt: %v", ErrPersist, err))
+	}
+
+	refund, err := payments.Refund(receipt.Payment, amount)
+	if err != nil {
+		receipt.Refunds = receipt.Refunds[:last:last]
+		pl.mu.Lock()
+		if serr := pl.saveReceiptLocked(receipt); serr != nil {
+			err = fmt.Errorf("%w; clearing the pending refund failed: %v", err, serr)
+		}
+		pl.mu.Unlock()
+		return Receipt{}, pl.errorf(receipt.Ticket.Plate, err)
+	}
+	refund.Reason = reason
+	pl.update(func() {
+		refund.Time = pl.now()
+		receipt.Refunds = append(receipt.Refunds[:last:last], refund)
+		if err = pl.saveReceiptLocked(receipt); err != nil {
+			err = fmt.Errorf("%w: receipt still shows refund %s pending: %v", ErrPersist, refund.ID, err)
+			return
+		}
+		pl.queueLocked(Event{Kind: EventRefunded, Plate: receipt.Ticket.Plate, Slot: receipt.Ticket.Slot, Ticket: ticketID, Fee: amount, Reason: reason})
+		err = pl.commitLocked(JournalEntry{Kind: JournalRefunded, Slot: receipt.Ticket.Slot, Plate: receipt.Ticket.Plate,
+			Ticket: ticketID, Fee: amount, Payment: &receipt.Payment, Refund: &refund})
+	})
+	if err != nil {
+		return receipt, pl.errorf(receipt.Ticket.Plate, err)
+	}
+	return receipt, nil
+}
+
+// Receipt returns the receipt of a paid exit.
+func (pl *ParkingLot) Receipt(ticketID string) (Receipt, error) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	r, err := pl.receiptsLocked().LoadReceipt(ticketID)
+	if err == nil && r.Lot != pl.Name {
+		err = fmt.Errorf("%w for ticket %s", ErrNoReceipt, ticketID)
+	}
+	if err != nil {
+		return Receipt{}, &LotError{Lot: pl.Name, Err: err}
+	}
+	return r, nil
+}
+
+// ReceiptsFor lists the plate's receipts in this lot, oldest first.
+func (pl *ParkingLot) ReceiptsFor(plate string) ([]Receipt, error) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	all, err := pl.receiptsLocked().ReceiptsFor(plate)
+	if err != nil {
+		return nil, pl.errorf(plate, err)
+	}
+	list := []Receipt{}
+	for _, r := range all {
+		if r.Lot == pl.Name {
+			list = append(list, r)
+		}
+	}
+	return list, nil
+}
+
+func (pl *ParkingLot) receiptsLocked() ReceiptStore {
+	if rs, ok := pl.Store.(ReceiptStore); ok {
+		return rs
+	}
+	return pl.receipts
+}
+
+// saveReceiptLocked needs the write lock, as it may create the in-memory
+// receipts.
+func (pl *ParkingLot) saveReceiptLocked(r Receipt) error {
+	if _, ok := pl.Store.(ReceiptStore); !ok && pl.receipts == nil {
+		pl.receipts = make(memoryReceipts)
+	}
+	return pl.receiptsLocked().SaveReceipt(r)
+}
+
+// Receipt finds the receipt of a ticket in whichever lot issued it.
+func (pm *ParkingManager) Receipt(ticketID string) (Receipt, error) {
+	for _, lot := range pm.lots() {
+		if r, err := lot.Receipt(ticketID); err == nil {
+			return r, nil
+		}
+	}
+	return Receipt{}, &LotError{Err: fmt.Errorf("%w for ticket %s", ErrNoReceipt, ticketID)}
+}
+
+// ReceiptsFor lists the plate's receipts from every lot.
+func (pm *ParkingManager) ReceiptsFor(plate string) ([]Receipt, error) {
+	list := []Receipt{}
+	for _, lot := range pm.lots() {
+		receipts, err := lot.ReceiptsFor(plate)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, receipts...)
+	}
+	return list, nil
+}
+
+// RefundTicket refunds a paid exit in whichever lot issued the ticket.
+func (pm *ParkingManager) RefundTicket(ticketID string, amount Money, reason string) (Receipt, error) {
+	receipt, err := pm.Receipt(ticketID)
+	if err != nil {
+		return Receipt{}, err
+	}
+	lot, err := pm.Lot(receipt.Lot)
+	if err != nil {
+		return Receipt{}, err
+	}
+	return lot.RefundTicket(ticketID, amount, reason)
+}
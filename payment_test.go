@@ -0,0 +1,262 @@
+// payment_test.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func paidLot(t *testing.T, gateway PaymentProcessor) (*ParkingLot, *FakeClock) {
+	t.Helper()
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	lot := NewParkingLot("Lot A", 2)
+	lot.SetClock(clock)
+	lot.SetPayments(gateway)
+	return lot, clock
+}
+
+func TestPayAndUnparkReleasesOnlyAfterPayment(t *testing.T) {
+	gateway := &MockGateway{Declines: map[PaymentMethod]bool{PayCard: true}}
+	lot, clock := paidLot(t, gateway)
+	events := recordEvents(lot)
+	ticket, _ := lot.ParkCarWithTicket(&Car{Number: "PY1"})
+	clock.Advance(30 * time.Minute)
+
+	if _, err := lot.PayAndUnpark(ExitPayment{Plate: "PY1", Method: PayCard}); !errors.Is(err, ErrPaymentDeclined) {
+		t.Fatalf("expected the card to be declined, got %v", err)
+	}
+	if _, err := lot.FindCar("PY1"); err != nil {
+		t.Fatalf("expected the car to stay parked after a declined payment: %v", err)
+	}
+	lot.flushObservers()
+	if kinds := eventKinds(*events); kinds[len(kinds)-1] != EventPaymentFailed {
+		t.Errorf("expected a payment_failed event, got %v", kinds)
+	}
+
+	receipt, err := lot.PayAndUnpark(ExitPayment{Ticket: ticket.ID, Method: PayUPI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Payment.Method != PayUPI || receipt.Payment.Amount != Rupees(60) || receipt.Quote.Total != Rupees(60) || receipt.Ticket.ID != ticket.ID {
+		t.Errorf("unexpected receipt %+v", receipt)
+	}
+	if paid := gateway.Payments(); len(paid) != 1 || paid[0].ID != receipt.Payment.ID {
+		t.Errorf("expected exactly one payment at the gateway, got %+v", paid)
+	}
+	if lot.FreeSlots() != 2 {
+		t.Errorf("expected the slot released once paid, got %d free", lot.FreeSlots())
+	}
+	if stored, err := lot.Receipt(ticket.ID); err != nil || stored.Payment != receipt.Payment {
+		t.Errorf("expected the receipt to be kept, got %+v (err %v)", stored, err)
+	}
+	if list, _ := lot.ReceiptsFor("PY1"); len(list) != 1 {
+		t.Errorf("expected one receipt for the plate, got %+v", list)
+	}
+}
+
+// blockingGateway holds each payment until release is closed.
+type blockingGateway struct {
+	MockGateway
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *blockingGateway) Pay(req PaymentRequest) (Payment, error) {
+	close(g.started)
+	<-g.release
+	return g.MockGateway.Pay(req)
+}
+
+func TestPaymentInProgressBlocksOtherExits(t *testing.T) {
+	gateway := &blockingGateway{started: make(chan struct{}), release: make(chan struct{})}
+	lot, clock := paidLot(t, gateway)
+	lot.ParkCar(&Car{Number: "PY2"})
+	clock.Advance(time.Minute)
+
+	done := make(chan error)
+	go func() {
+		_, err := lot.PayAndUnpark(ExitPayment{Plate: "PY2", Method: PayWallet})
+		done <- err
+	}()
+	<-gateway.started
+	if _, err := lot.UnparkCar("PY2"); !errors.Is(err, ErrPaymentPending) {
+		t.Errorf("expected a plain exit to wait for the payment, got %v", err)
+	}
+	if _, err := lot.FindCar("PY2"); err != nil {
+		t.Errorf("expected the car parked while paying: %v", err)
+	}
+	close(gateway.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storeFailingGateway breaks the lot's store once it has taken payment.
+type storeFailingGateway struct {
+	MockGateway
+	store *failingStore
+}
+
+func (g *storeFailingGateway) Pay(req PaymentRequest) (Payment, error) {
+	g.store.fail = true
+	return g.MockGateway.Pay(req)
+}
+
+func TestPaymentIsRefundedWhenExitFails(t *testing.T) {
+	store := &failingStore{}
+	gateway := &storeFailingGateway{store: store}
+	lot, clock := paidLot(t, gateway)
+	lot.SetStore(store)
+	lot.ParkCar(&Car{Number: "PY3"})
+	clock.Advance(time.Minute)
+
+	if _, err := lot.PayAndUnpark(ExitPayment{Plate: "PY3", Method: PayCard}); !errors.Is(err, ErrPersist) {
+		t.Fatalf("expected the exit to fail, got %v", err)
+	}
+	if len(gateway.refunds) != 1 || gateway.refunds[0].Amount != Rupees(2) {
+		t.Errorf("expected the payment refunded, got %+v", gateway.refunds)
+	}
+	store.fail = false
+	lot.SetPayments(DefaultPayments)
+	if _, err := lot.PayAndUnpark(ExitPayment{Plate: "PY3", Method: PayCash}); err != nil {
+		t.Errorf("expected the car to be able to pay again: %v", err)
+	}
+}
+
+func TestRefundTicket(t *testing.T) {
+	lot, clock := paidLot(t, nil)
+	ticket, _ := lot.ParkCarWithTicket(&Car{Number: "PY4"})
+	clock.Advance(time.Hour)
+	if _, err := lot.PayAndUnpark(ExitPayment{Plate: "PY4", Method: PayCard}); !errors.Is(err, ErrPaymentMethod) {
+		t.Errorf("expected lots without a processor to take cash only, got %v", err)
+	}
+	if _, err := lot.PayAndUnpark(ExitPayment{Plate: "PY4", Method: PayCash}); err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := lot.RefundTicket(ticket.ID, Rupees(20), "barrier fault")
+	if err != nil || receipt.Refunded() != Rupees(20) || receipt.Refunds[0].Reason != "barrier fault" {
+		t.Fatalf("unexpected partial refund %+v (err %v)", receipt, err)
+	}
+	if _, err := lot.RefundTicket(ticket.ID, Rupees(101), ""); !errors.Is(err, ErrRefundExceeds) {
+		t.Errorf("expected a refund beyond the balance to fail, got %v", err)
+	}
+	if receipt, err = lot.RefundTicket(ticket.ID, Money{}, "goodwill"); err != nil || receipt.Refunded() != Rupees(120) {
+		t.Errorf("expected the rest refunded, got %+v (err %v)", receipt, err)
+	}
+	if _, err := lot.RefundTicket("T-nope", Money{}, ""); !errors.Is(err, ErrNoReceipt) {
+		t.Errorf("expected no receipt, got %v", err)
+	}
+}
+
+// receiptFailingStore keeps receipts in memory until told to fail.
+type receiptFailingStore struct {
+	MemoryStore
+	memoryReceipts
+	fail bool
+}
+
+func (s *receiptFailingStore) SaveReceipt(r Receipt) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.memoryReceipts.SaveReceipt(r)
+}
+
+type refundFailingGateway struct{ MockGateway }
+
+func (g *refundFailingGateway) Refund(Payment, Money) (Refund, error) {
+	return Refund{}, errors.New("gateway timeout")
+}
+
+func TestRefundIsRecordedBeforeTheGatewayPays(t *testing.T) {
+	gateway := &MockGateway{}
+	lot, clock := paidLot(t, gateway)
+	store := &receiptFailingStore{memoryReceipts: make(memoryReceipts)}
+	lot.SetStore(store)
+	ticket, _ := lot.ParkCarWithTicket(&Car{Number: "PY6"})
+	clock.Advance(time.Hour)
+	if _, err := lot.PayAndUnpark(ExitPayment{Plate: "PY6", Method: PayCard}); err != nil {
+		t.Fatal(err)
+	}
+
+	store.fail = true
+	if _, err := lot.RefundTicket(ticket.ID, Money{}, ""); !errors.Is(err, ErrPersist) {
+		t.Fatalf("expected the refund refused when its receipt cannot be saved, got %v", err)
+	}
+	if len(gateway.refunds) != 0 {
+		t.Errorf("expected no money given back without a record, got %+v", gateway.refunds)
+	}
+
+	store.fail = false
+	lot.SetPayments(&refundFailingGateway{})
+	if _, err := lot.RefundTicket(ticket.ID, Money{}, ""); err == nil {
+		t.Fatal("expected the gateway failure reported")
+	}
+	if r, _ := lot.Receipt(ticket.ID); len(r.Refunds) != 0 {
+		t.Errorf("expected the pending refund cleared after the gateway failed, got %+v", r.Refunds)
+	}
+
+	lot.SetPayments(gateway)
+	r, err := lot.RefundTicket(ticket.ID, Money{}, "")
+	if err != nil || len(r.Refunds) != 1 || r.Refunds[0].Pending || r.Refunds[0].ID != gateway.refunds[0].ID {
+		t.Fatalf("expected the gateway refund on the receipt, got %+v (err %v)", r.Refunds, err)
+	}
+	if saved, _ := lot.Receipt(ticket.ID); len(saved.Refunds) != 1 || saved.Refunds[0].Pending {
+		t.Errorf("expected the saved receipt to show the refund done, got %+v", saved.Refunds)
+	}
+}
+
+func TestReceiptsSurviveRestart(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lot, clock := paidLot(t, &MockGateway{})
+	lot.SetStore(store)
+	ticket, _ := lot.ParkCarWithTicket(&Car{Number: "PY5"})
+	clock.Advance(10 * time.Minute)
+	if _, err := lot.PayAndUnpark(ExitPayment{Plate: "PY5", Method: PayUPI}); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := LoadParkingManager(store)
+	if err != nil || len(manager.Lots) != 1 {
+		t.Fatalf("expected the lot back, got %+v (err %v)", manager.Lots, err)
+	}
+	receipts, err := manager.ReceiptsFor("PY5")
+	if err != nil || len(receipts) != 1 || receipts[0].Ticket.ID != ticket.ID || receipts[0].Payment.Amount != Rupees(20) {
+		t.Errorf("expected the receipt after a restart, got %+v (err %v)", receipts, err)
+	}
+}
+
+func TestCLIPaidExitAndRefund(t *testing.T) {
+	dir := t.TempDir()
+	runCLITest(t, dir, exitOK, "lots", "create", "Lot A", "-slots", "2")
+	runCLITest(t, dir, exitOK, "park", "CP9")
+	runCLITest(t, dir, exitUsage, "charge", "CP9", "-pay", "cheque")
+
+	var charged exitResponse
+	out := runCLITest(t, dir, exitOK, "charge", "CP9", "-pay", "card", "-json")
+	if err := json.Unmarshal([]byte(out), &charged); err != nil || charged.Receipt == nil || charged.Receipt.Payment.Method != PayCard {
+		t.Fatalf("unexpected charge output %q", out)
+	}
+	var refunded Receipt
+	out = runCLITest(t, dir, exitOK, "refund", charged.Ticket.ID, "-json")
+	if err := json.Unmarshal([]byte(out), &refunded); err != nil || refunded.Refunded() != charged.Fee {
+		t.Errorf("unexpected refund output %q", out)
+	}
+	// Each run has its own gateway; the IDs it hands out must not repeat.
+	if id := refunded.Refunds[0].ID; id == charged.Receipt.Payment.ID {
+		t.Errorf("expected the refund ID to differ from the payment's, both %s", id)
+	}
+	runCLITest(t, dir, exitConflict, "refund", charged.Ticket.ID)
+
+	var report Report
+	out = runCLITest(t, dir, exitOK, "report", "-json")
+	if err := json.Unmarshal([]byte(out), &report); err != nil || len(report.Lots) != 1 || !report.Lots[0].Revenue.IsZero() {
+		t.Errorf("expected the refund to cancel the revenue, got %q", out)
+	}
+}
@@ -0,0 +1,157 @@
+// plates.go
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DuplicatePlateError is returned when a car is parked while the same
+// plate is already parked in this lot or another lot of the same manager.
+type DuplicatePlateError struct {
+	Plate string
+	Lot   string
+	Slot  int
+}
+
+func (e *DuplicatePlateError) Error() string {
+	return fmt.Sprintf("car %s is already parked in %s at slot %d", e.Plate, e.Lot, e.Slot)
+}
+
+type plateEntry struct {
+	lot  *ParkingLot
+	slot int
+}
+
+// plateRegistry records where every plate under one ParkingManager is
+// parked. Lots claim a plate while holding their own lock, so the lock
+// order is always manager, then lot, then registry.
+type plateRegistry struct {
+	mu     sync.Mutex
+	parked map[string]plateEntry
+}
+
+func newPlateRegistry() *plateRegistry {
+	return &plateRegistry{parked: make(map[string]plateEntry)}
+}
+
+func (r *plateRegistry) claim(plate string, lot *ParkingLot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.parked[plate]; ok {
+		return &DuplicatePlateError{Plate: plate, Lot: entry.lot.Name, Slot: entry.slot}
+	}
+	r.parked[plate] = plateEntry{lot: lot}
+	return nil
+}
+
+func (r *plateRegistry) check(plate string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.parked[plate]; ok {
+		return &DuplicatePlateError{Plate: plate, Lot: entry.lot.Name, Slot: entry.slot}
+	}
+	return nil
+}
+
+func (r *plateRegistry) setSlot(plate string, lot *ParkingLot, slot int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.parked[plate]; ok && entry.lot == lot {
+		r.parked[plate] = plateEntry{lot: lot, slot: slot}
+	}
+}
+
+func (r *plateRegistry) release(plate string, lot *ParkingLot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.parked[plate]; ok && entry.lot == lot {
+		delete(r.parked, plate)
+	}
+}
+
+// claimPlateLocked rejects a plate already parked in this lot or, when the
+// lot belongs to a manager, anywhere under that manager.
+func (pl *ParkingLot) claimPlateLocked(plate string) error {
+	if i := pl.findLocked(plate); i >= 0 {
+		return &DuplicatePlateError{Plate: plate, Lot: pl.Name, Slot: pl.Slots[i].Number}
+	}
+	if pl.plates == nil {
+		return nil
+	}
+	return pl.plates.claim(plate, pl)
+}
+
+func (pl *ParkingLot) releasePlateLocked(plate string) {
+	if pl.plates != nil {
+		pl.plates.release(plate, pl)
+	}
+}
+
+// attach joins the lot to a manager's registry, registering the cars
+// already parked in it. The caller holds the manager's lock.
+func (pl *ParkingLot) attach(registry *plateRegistry) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	pl.plates = registry
+	for _, slot := range pl.Slots {
+		if slot.IsEmpty || slot.SpanHead != 0 {
+			continue
+		}
+		if registry.claim(slot.Car.Number, pl) == nil {
+			registry.setSlot(slot.Car.Number, pl, slot.Number)
+		}
+	}
+}
+
+// NewParkingManager builds a manager whose lots share one plate registry
+// from the start.
+func NewParkingManager(lots ...*ParkingLot) *ParkingManager {
+	pm := &ParkingManager{}
+	for _, lot := range lots {
+		pm.AddLot(lot)
+	}
+	return pm
+}
+
+// attachLotsLocked makes sure every lot in pm.Lots uses the manager's
+// registry, including lots appended to the exported slice directly.
+func (pm *ParkingManager) attachLotsLocked() {
+	if pm.plates == nil {
+		pm.plates = newPlateRegistry()
+		pm.attached = make(map[*ParkingLot]bool)
+	}
+	for _, lot := range pm.Lots {
+		if !pm.attached[lot] {
+			lot.attach(pm.plates)
+			pm.attached[lot] = true
+		}
+	}
+}
+
+func (pm *ParkingManager) registry() *plateRegistry {
+	pm.lots()
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.plates
+}
+
+func (pm *ParkingManager) allAttachedLocked() bool {
+	if pm.plates == nil {
+		return len(pm.Lots) == 0
+	}
+	for _, lot := range pm.Lots {
+		if !pm.attached[lot] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+// plates_test.go
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestDuplicatePlateRejectedInSameLot(t *testing.T) {
+	lot := NewParkingLot("Lot A", 3)
+	_, _ = lot.ParkCar(&Car{Number: "KA01DP0001"})
+
+	_, err := lot.ParkCar(&Car{Number: "KA01DP0001"})
+	var dup *DuplicatePlateError
+	if !errors.As(err, &dup) {
+		t.Fatalf("expected DuplicatePlateError, got %v", err)
+	}
+	if dup.Lot != "Lot A" || dup.Slot != 1 {
+		t.Errorf("expected duplicate reported at Lot A slot 1, got %s slot %d", dup.Lot, dup.Slot)
+	}
+}
+
+func TestDuplicatePlateRejectedAcrossManagedLots(t *testing.T) {
+	lotA := NewParkingLot("Lot A", 2)
+	lotB := NewParkingLot("Lot B", 2)
+	manager := NewParkingManager(lotA, lotB)
+
+	if _, err := lotA.ParkCar(&Car{Number: "KA01DP0002"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var dup *DuplicatePlateError
+	if _, err := lotB.ParkCar(&Car{Number: "KA01DP0002"}); !errors.As(err, &dup) || dup.Lot != "Lot A" {
+		t.Errorf("expected lot B to reject plate parked in Lot A, got %v", err)
+	}
+	if _, _, err := manager.ParkEvenly(&Car{Number: "KA01DP0002"}); !errors.As(err, &dup) {
+		t.Errorf("expected ParkEvenly to reject duplicate, got %v", err)
+	}
+	if _, _, err := manager.ParkLargeVehicle(&Car{Number: "KA01DP0002", Size: SizeLarge}); !errors.As(err, &dup) {
+		t.Errorf("expected ParkLargeVehicle to reject duplicate, got %v", err)
+	}
+
+	// Once unparked the plate may be parked again anywhere.
+	_, _ = lotA.UnparkCar("KA01DP0002")
+	if _, err := lotB.ParkCar(&Car{Number: "KA01DP0002"}); err != nil {
+		t.Errorf("expected re-park after unpark to succeed, got %v", err)
+	}
+}
+
+func TestDuplicatePlateAcrossLotsParkedDirectly(t *testing.T) {
+	lotA := NewParkingLot("Lot A", 2)
+	lotB := NewParkingLot("Lot B", 2)
+	NewParkingManager(lotA, lotB)
+
+	if _, err := lotA.ParkCar(&Car{Number: "KA01DP0004"}); err != nil {
+		t.Fatal(err)
+	}
+	var dup *DuplicatePlateError
+	if _, err := lotB.ParkCar(&Car{Number: "KA01DP0004"}); !errors.As(err, &dup) || dup.Lot != "Lot A" {
+		t.Errorf("expected the plate refused in Lot B, got %v", err)
+	}
+
+	// A literal manager catches it too once it has been used.
+	lotC, lotD := NewParkingLot("Lot C", 2), NewParkingLot("Lot D", 2)
+	literal := &ParkingManager{Lots: []*ParkingLot{lotC, lotD}}
+	if _, err := literal.Lot("Lot C"); err != nil {
+		t.Fatal(err)
+	}
+	lotC.ParkCar(&Car{Number: "KA01DP0005"})
+	if _, err := lotD.ParkCar(&Car{Number: "KA01DP0005"}); !errors.As(err, &dup) {
+		t.Errorf("expected the literal manager's lots to share plates after first use, got %v", err)
+	}
+}
+
+func TestDuplicatePlateRegisteredForLiteralManager(t *testing.T) {
+	lotA := NewParkingLot("Lot A", 1)
+	lotB := NewParkingLot("Lot B", 2)
+	_, _ = lotA.ParkCar(&Car{Number: "KA01DP0003"})
+	manager := &ParkingManager{Lots: []*ParkingLot{lotA, lotB}}
+
+	// Lot A is full, so the plate is only found through the registry.
+	var dup *DuplicatePlateError
+	if _, _, err := manager.ParkEvenly(&Car{Number: "KA01DP0003"}); !errors.As(err, &dup) || dup.Slot != 1 {
+		t.Errorf("expected duplicate at Lot A slot 1, got %v", err)
+	}
+}
+
+func TestConcurrentDuplicatePlateParksOnce(t *testing.T) {
+	lotA := NewParkingLot("Lot A", 10)
+	lotB := NewParkingLot("Lot B", 10)
+	NewParkingManager(lotA, lotB)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	successes := 0
+	for i := 0; i < 20; i++ {
+		lot := lotA
+		if i%2 == 1 {
+			lot = lotB
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := lot.ParkCar(&Car{Number: "SAME"}); err == nil {
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if successes != 1 {
+		t.Errorf("expected exactly one successful park, got %d", successes)
+	}
+}
@@ -0,0 +1,353 @@
+// report.go
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var ErrNoJournal = errors.New("no journal to report from")
+
+// Report sums up the journal from From up to, not including, To: revenue
+// and traffic per lot and per attendant, and how full each lot was hour
+// by hour. Revenue is what was charged less what was refunded.
+type Report struct {
+	From       time.Time
+	To         time.Time
+	Lots       []LotReport
+	Attendants []AttendantReport
+}
+
+type LotReport struct {
+	Lot                 string
+	Capacity            int
+	Entries             int
+	Exits               int
+	Revenue             Money
+	Refunded            Money
+	AverageDwellMinutes float64   // of the cars that left in the range
+	PeakOccupancy       int       // slots taken, a bus counting for each slot it spans
+	PeakAt              time.Time `json:",omitzero"`
+	Hourly              []HourlyOccupancy
+}
+
+type HourlyOccupancy struct {
+	Start   time.Time
+	Average float64 // slots taken, averaged over the hour
+	Peak    int
+}
+
+// AttendantReport covers the cars an attendant parked. Cars parked
+// without an attendant are counted in their lot only.
+type AttendantReport struct {
+	Lot       string
+	Attendant string
+	Entries   int
+	Exits     int
+	Revenue   Money
+}
+
+// BuildReport computes the report from journal entries in the order they
+// were written. Entries before from still count towards occupancy, as the
+// lots may already hold cars when the range starts; reverted changes are
+// skipped. A lot whose fees in the range are in more than one currency is
+// refused with ErrMixedCurrencies.
+func BuildReport(entries []JournalEntry, from, to time.Time) (Report, error) {
+	reverted := revertedChanges(entries)
+	inRange := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+
+	lots := make(map[string]*lotTally)
+	attendants := make(map[[2]string]*AttendantReport)
+	attendant := func(lot, name string) *AttendantReport {
+		if name == "" {
+			return &AttendantReport{} // counted nowhere
+		}
+		a := attendants[[2]string{lot, name}]
+		if a == nil {
+			a = &AttendantReport{Lot: lot, Attendant: name}
+			attendants[[2]string{lot, name}] = a
+		}
+		return a
+	}
+	parkedBy := make(map[string]string) // ticket to attendant, for refunds
+	var err error
+	add := func(lot string, total *Money, m Money) {
+		if err != nil {
+			return
+		}
+		var sum Money
+		if sum, err = total.addChecked(m); err != nil {
+			err = &LotError{Lot: lot, Err: err}
+			return
+		}
+		*total = sum
+	}
+
+	for _, e := range entries {
+		if reverted[e.Change] || !e.Time.Before(to) {
+			continue
+		}
+		t := lots[e.Lot]
+		if e.Kind == JournalLot {
+			if t == nil {
+				t = newLotTally(e.Lot, from, to)
+				lots[e.Lot] = t
+			}
+			t.reset(e.Time, *e.Layout)
+			continue
+		}
+		if t == nil {
+			continue // never registered; Replay refuses such a journal
+		}
+		switch e.Kind {
+		case JournalParked:
+			span := max(e.Span, 1)
+			t.stays[e.Plate] = stay{at: e.Time, span: span}
+			t.occupy(e.Time, span)
+			if inRange(e.Time) {
+				t.Entries++
+				attendant(e.Lot, e.Attendant).Entries++
+			}
+		case JournalUnparked:
+			s, known := t.stays[e.Plate]
+			delete(t.stays, e.Plate)
+			t.occupy(e.Time, -max(s.span, 1))
+			if inRange(e.Time) {
+				t.Exits++
+				attendant(e.Lot, e.Attendant).Exits++
+				if known {
+					t.dwell += e.Time.Sub(s.at)
+					t.dwelled++
+				}
+			}
+		case JournalCharged:
+			if e.Ticket != "" {
+				parkedBy[e.Ticket] = e.Attendant
+			}
+			if inRange(e.Time) {
+				add(e.Lot, &t.Revenue, e.Fee)
+				add(e.Lot, &attendant(e.Lot, e.Attendant).Revenue, e.Fee)
+			}
+		case JournalRefunded:
+			if inRange(e.Time) {
+				add(e.Lot, &t.Revenue, e.Fee.Neg())
+				add(e.Lot, &t.Refunded, e.Fee)
+				add(e.Lot, &attendant(e.Lot, parkedBy[e.Ticket]).Revenue, e.Fee.Neg())
+			}
+		}
+	}
+	if err != nil {
+		return Report{}, err
+	}
+
+	r := Report{From: from, To: to, Lots: []LotReport{}, Attendants: []AttendantReport{}}
+	for _, t := range lots {
+		r.Lots = append(r.Lots, t.finish())
+	}
+	sort.Slice(r.Lots, func(i, j int) bool { return r.Lots[i].Lot < r.Lots[j].Lot })
+	for _, a := range attendants {
+		r.Attendants = append(r.Attendants, *a)
+	}
+	sort.Slice(r.Attendants, func(i, j int) bool {
+		if r.Attendants[i].Lot != r.Attendants[j].Lot {
+			return r.Attendants[i].Lot < r.Attendants[j].Lot
+		}
+		return r.Attendants[i].Attendant < r.Attendants[j].Attendant
+	})
+	return r, nil
+}
+
+// ReportFile builds the report from the journal at path.
+func ReportFile(path string, from, to time.Time) (Report, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Report{}, fmt.Errorf("%w at %s", ErrNoJournal, path)
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	defer f.Close()
+	entries, err := ReadJournal(f)
+	if err != nil {
+		return Report{}, err
+	}
+	return BuildReport(entries, from, to)
+}
+
+// ParseReportRange reads the days a report covers, each YYYY-MM-DD in
+// now's location: from the start of from through the end of to. An empty
+// from is today and an empty to is the same day as from.
+func ParseReportRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if from != "" {
+		var err error
+		if start, err = time.ParseInLocation(time.DateOnly, from, now.Location()); err != nil {
+			return time.Time{}, time.Time{}, badRequest("from must be YYYY-MM-DD")
+		}
+	}
+	end := start
+	if to != "" {
+		var err error
+		if end, err = time.ParseInLocation(time.DateOnly, to, now.Location()); err != nil {
+			return time.Time{}, time.Time{}, badRequest("to must be YYYY-MM-DD")
+		}
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, badRequest("the report must end on or after the day it starts")
+	}
+	return start, end.AddDate(0, 0, 1), nil
+}
+
+// The tables a report exports as CSV.
+const (
+	ReportLots       = "lots"
+	ReportAttendants = "attendants"
+	ReportHourly     = "hourly"
+)
+
+// WriteCSV writes one of the report's tables with a header row. Amounts
+// are decimals in the currency column's units.
+func (r Report) WriteCSV(w io.Writer, table string) error {
+	var rows [][]string
+	switch table {
+	case ReportLots, "":
+		rows = append(rows, []string{"lot", "capacity", "entries", "exits", "revenue", "refunded", "currency",
+			"average_dwell_minutes", "peak_occupancy", "peak_at"})
+		for _, l := range r.Lots {
+			peakAt := ""
+			if !l.PeakAt.IsZero() {
+				peakAt = l.PeakAt.Format(time.RFC3339)
+			}
+			rows = append(rows, []string{l.Lot, strconv.Itoa(l.Capacity), strconv.Itoa(l.Entries), strconv.Itoa(l.Exits),
+				l.Revenue.Decimal(), l.Refunded.Decimal(), currencyOf(l.Revenue, l.Refunded),
+				formatFloat(l.AverageDwellMinutes), strconv.Itoa(l.PeakOccupancy), peakAt})
+		}
+	case ReportAttendants:
+		rows = append(rows, []string{"lot", "attendant", "entries", "exits", "revenue", "currency"})
+		for _, a := range r.Attendants {
+			rows = append(rows, []string{a.Lot, a.Attendant, strconv.Itoa(a.Entries), strconv.Itoa(a.Exits),
+				a.Revenue.Decimal(), currencyOf(a.Revenue)})
+		}
+	case ReportHourly:
+		rows = append(rows, []string{"lot", "hour", "average_occupancy", "peak_occupancy"})
+		for _, l := range r.Lots {
+			for _, h := range l.Hourly {
+				rows = append(rows, []string{l.Lot, h.Start.Format(time.RFC3339), formatFloat(h.Average), strconv.Itoa(h.Peak)})
+			}
+		}
+	default:
+		return badRequest(fmt.Sprintf("unknown report table %q: want lots, attendants or hourly", table))
+	}
+	cw := csv.NewWriter(w)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
+
+func currencyOf(amounts ...Money) string {
+	for _, m := range amounts {
+		if m.Currency != "" {
+			return m.Currency
+		}
+	}
+	return DefaultCurrency
+}
+
+func formatFloat(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+func round2(f float64) float64 { return math.Round(f*100) / 100 }
+
+type stay struct {
+	at   time.Time
+	span int
+}
+
+// lotTally follows one lot through the journal. Occupancy is integrated
+// over time into the hours of the report as it changes.
+type lotTally struct {
+	LotReport
+	from, to time.Time
+	occupied int
+	since    time.Time // when occupied last changed
+	stays    map[string]stay
+	dwell    time.Duration
+	dwelled  int
+	area     []time.Duration // slot-time taken in each hour
+}
+
+func newLotTally(lot string, from, to time.Time) *lotTally {
+	hours := int((to.Sub(from) + time.Hour - 1) / time.Hour)
+	t := &lotTally{LotReport: LotReport{Lot: lot, Hourly: make([]HourlyOccupancy, max(hours, 0))},
+		from: from, to: to, since: from, stays: make(map[string]stay), area: make([]time.Duration, max(hours, 0))}
+	for h := range t.Hourly {
+		t.Hourly[h].Start = from.Add(time.Duration(h) * time.Hour)
+	}
+	return t
+}
+
+// reset takes the lot's state from a snapshot journaled at the given time.
+func (t *lotTally) reset(at time.Time, snapshot LotSnapshot) {
+	t.advance(at)
+	t.Capacity = len(snapshot.Slots)
+	t.occupied = 0
+	clear(t.stays)
+	for _, slot := range snapshot.Slots {
+		if slot.IsEmpty || slot.Car == nil {
+			continue
+		}
+		t.occupied++
+		s := t.stays[slot.Car.Number]
+		t.stays[slot.Car.Number] = stay{at: slot.Car.ParkedAt, span: s.span + 1}
+	}
+}
+
+func (t *lotTally) occupy(at time.Time, delta int) {
+	t.advance(at)
+	t.occupied = max(t.occupied+delta, 0)
+}
+
+// advance accounts for the current occupancy from since up to at, clipped
+// to the report's range.
+func (t *lotTally) advance(at time.Time) {
+	start, end := t.since, at
+	if start.Before(t.from) {
+		start = t.from
+	}
+	if end.After(t.to) {
+		end = t.to
+	}
+	for start.Before(end) {
+		h := int(start.Sub(t.from) / time.Hour)
+		next := t.Hourly[h].Start.Add(time.Hour)
+		if next.After(end) {
+			next = end
+		}
+		t.area[h] += time.Duration(t.occupied) * next.Sub(start)
+		t.Hourly[h].Peak = max(t.Hourly[h].Peak, t.occupied)
+		if t.occupied > t.PeakOccupancy {
+			t.PeakOccupancy, t.PeakAt = t.occupied, start
+		}
+		start = next
+	}
+	if at.After(t.since) {
+		t.since = at
+	}
+}
+
+func (t *lotTally) finish() LotReport {
+	t.advance(t.to)
+	for h := range t.Hourly {
+		hour := min(time.Hour, t.to.Sub(t.Hourly[h].Start))
+		t.Hourly[h].Average = round2(float64(t.area[h]) / float64(hour))
+	}
+	if t.dwelled > 0 {
+		t.AverageDwellMinutes = round2(t.dwell.Minutes() / float64(t.dwelled))
+	}
+	return t.LotReport
+}
@@ -0,0 +1,163 @@
+// report_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// reportedDay journals a morning in Lot A and a car in Lot B the next day.
+func reportedDay(t *testing.T) (path string, manager *ParkingManager) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), "journal.jsonl")
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	manager = journaledManager(t, path, clock)
+	lotA, lotB := manager.Lots[0], manager.Lots[1]
+
+	vik := &Attendant{Name: "Vik", Lot: lotA}
+	ticket, _ := vik.ParkCarWithTicket(&Car{Number: "R1"})
+	clock.Advance(30 * time.Minute)
+	lotA.ParkCar(&Car{Number: "R2"})
+	clock.Advance(30 * time.Minute)
+	if _, err := lotA.PayAndUnpark(ExitPayment{Plate: "R1", Method: PayCash}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lotA.RefundTicket(ticket.ID, Rupees(20), "late barrier"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Minute)
+	lotA.UnparkCarAndCharge("R2")
+
+	clock.Set(time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC))
+	lotB.ParkCar(&Car{Number: "R3"})
+	return path, manager
+}
+
+func TestReportRevenueTrafficAndOccupancy(t *testing.T) {
+	path, _ := reportedDay(t)
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	r, err := ReportFile(path, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Lots) != 2 {
+		t.Fatalf("expected both lots, got %+v", r.Lots)
+	}
+
+	a := r.Lots[0]
+	if a.Lot != "Lot A" || a.Capacity != 3 || a.Entries != 2 || a.Exits != 2 || a.AverageDwellMinutes != 60 {
+		t.Errorf("unexpected traffic %+v", a)
+	}
+	// ₹120 for each hour-long stay, less the refund.
+	if a.Revenue != Rupees(220) || a.Refunded != Rupees(20) {
+		t.Errorf("expected ₹220 after a ₹20 refund, got %s (refunded %s)", a.Revenue, a.Refunded)
+	}
+	if a.PeakOccupancy != 2 || !a.PeakAt.Equal(day.Add(9*time.Hour+30*time.Minute)) {
+		t.Errorf("expected a peak of 2 at 09:30, got %d at %s", a.PeakOccupancy, a.PeakAt)
+	}
+	if len(a.Hourly) != 24 || a.Hourly[9].Average != 1.5 || a.Hourly[9].Peak != 2 || a.Hourly[10].Average != 0.5 || a.Hourly[11].Peak != 0 {
+		t.Errorf("unexpected hourly occupancy %+v", a.Hourly[8:12])
+	}
+	if b := r.Lots[1]; b.Entries != 0 || b.PeakOccupancy != 0 {
+		t.Errorf("expected the next day's car left out, got %+v", b)
+	}
+
+	if len(r.Attendants) != 1 || r.Attendants[0] != (AttendantReport{Lot: "Lot A", Attendant: "Vik", Entries: 1, Exits: 1, Revenue: Rupees(100)}) {
+		t.Errorf("unexpected attendants %+v", r.Attendants)
+	}
+
+	// The car parked the day before still fills Lot B the day after.
+	next, _ := ReportFile(path, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2))
+	if b := next.Lots[1]; b.Entries != 1 || b.PeakOccupancy != 1 || b.Hourly[23].Average != 1 {
+		t.Errorf("unexpected next day in Lot B %+v", b)
+	}
+}
+
+func TestReportCSV(t *testing.T) {
+	path, _ := reportedDay(t)
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	r, err := ReportFile(path, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for table, want := range map[string][]string{
+		ReportLots:       {"Lot A", "3", "2", "2", "220.00", "20.00", "INR", "60", "2", "2024-03-04T09:30:00Z"},
+		ReportAttendants: {"Lot A", "Vik", "1", "1", "100.00", "INR"},
+		ReportHourly:     {"Lot A", "2024-03-04T00:00:00Z", "0", "0"},
+	} {
+		var buf bytes.Buffer
+		if err := r.WriteCSV(&buf, table); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(&buf).ReadAll()
+		if err != nil || len(rows) < 2 || len(rows[1]) != len(want) {
+			t.Fatalf("%s: unexpected CSV %q (err %v)", table, rows, err)
+		}
+		for i := range want {
+			if rows[1][i] != want[i] {
+				t.Errorf("%s: column %s is %q, want %q", table, rows[0][i], rows[1][i], want[i])
+			}
+		}
+	}
+	if err := r.WriteCSV(&bytes.Buffer{}, "weekly"); statusFor(err) != http.StatusBadRequest {
+		t.Errorf("expected an unknown table to be refused, got %v", err)
+	}
+}
+
+func TestServerReports(t *testing.T) {
+	path, manager := reportedDay(t)
+	server := NewServer(manager)
+	t.Cleanup(server.Close)
+	serve(t, server, "GET", "/reports?from=2024-03-04", "", http.StatusNotFound, nil)
+
+	server.Journal = path
+	var r Report
+	serve(t, server, "GET", "/reports?from=2024-03-04&to=2024-03-05", "", http.StatusOK, &r)
+	if len(r.Lots) != 2 || r.Lots[0].Entries != 2 || r.Lots[1].Entries != 1 || len(r.Lots[0].Hourly) != 48 {
+		t.Errorf("unexpected two-day report %+v", r.Lots)
+	}
+	serve(t, server, "GET", "/reports?from=2024-03-05&to=2024-03-04", "", http.StatusBadRequest, nil)
+	serve(t, server, "GET", "/reports?format=xml", "", http.StatusBadRequest, nil)
+	serve(t, server, "GET", "/reports?format=csv&table=hourly", "", http.StatusOK, nil)
+}
+
+func TestCLIReportCSV(t *testing.T) {
+	dir := t.TempDir()
+	runCLITest(t, dir, exitOK, "lots", "create", "Lot A", "-slots", "2")
+	runCLITest(t, dir, exitOK, "park", "CR1", "-lot", "Lot A", "-attendant", "Asha")
+	runCLITest(t, dir, exitOK, "charge", "CR1")
+	runCLITest(t, dir, exitUsage, "report", "-date", "2024-03-04", "-from", "2024-03-04")
+
+	out := runCLITest(t, dir, exitOK, "report", "-csv", "attendants")
+	rows, err := csv.NewReader(bytes.NewBufferString(out)).ReadAll()
+	if err != nil || len(rows) != 2 || rows[1][1] != "Asha" || rows[1][2] != "1" || rows[1][3] != "1" {
+		t.Errorf("unexpected attendants CSV %q", out)
+	}
+}
+
+func TestReportRefusesMixedCurrencies(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	at := day.Add(9 * time.Hour)
+	layout := func(name string) *LotSnapshot { return &LotSnapshot{Name: name, Slots: NewParkingLot(name, 1).Slots} }
+	entries := []JournalEntry{
+		{Change: 1, Time: at, Kind: JournalLot, Lot: "Lot A", Layout: layout("Lot A")},
+		{Change: 2, Time: at, Kind: JournalLot, Lot: "Lot B", Layout: layout("Lot B")},
+		{Change: 3, Time: at, Kind: JournalCharged, Lot: "Lot A", Fee: Rupees(40)},
+		{Change: 4, Time: at, Kind: JournalCharged, Lot: "Lot B", Fee: Money{Amount: 500, Currency: "USD"}},
+	}
+	r, err := BuildReport(entries, day, day.AddDate(0, 0, 1))
+	if err != nil || r.Lots[0].Revenue != Rupees(40) || r.Lots[1].Revenue != (Money{Amount: 500, Currency: "USD"}) {
+		t.Fatalf("expected each lot in its own currency, got %+v (err %v)", r.Lots, err)
+	}
+
+	// Lot A switched to dollars during the day.
+	entries = append(entries, JournalEntry{Change: 5, Time: at, Kind: JournalCharged, Lot: "Lot A", Fee: Money{Amount: 300, Currency: "USD"}})
+	if _, err := BuildReport(entries, day, day.AddDate(0, 0, 1)); !errors.Is(err, ErrMixedCurrencies) || statusFor(err) != http.StatusUnprocessableEntity {
+		t.Errorf("expected mixed currencies to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,431 @@
+// reservation.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+var (
+	ErrInvalidReservation = errors.New("invalid reservation")
+	ErrNoReservationSlot  = errors.New("no slot left to reserve")
+	ErrReservationClash   = errors.New("plate already has a reservation for that time")
+	ErrUnknownReservation = errors.New("unknown reservation")
+)
+
+// DefaultReservationGrace is how long a held slot waits past the start of
+// the window before the reservation expires as a no-show.
+const DefaultReservationGrace = 15 * time.Minute
+
+type ReservationStatus string
+
+const (
+	ReservationBooked    ReservationStatus = "booked"    // the window has not started, or no slot could be held yet
+	ReservationHeld      ReservationStatus = "held"      // HeldSlot is kept free for the plate
+	ReservationFulfilled ReservationStatus = "fulfilled" // the plate parked; its car carries the reservation ID
+	ReservationNoShow    ReservationStatus = "no_show"   // expired after the grace period; Fee was charged
+	ReservationCancelled ReservationStatus = "cancelled"
+)
+
+// Reservation books a slot of a size class, or one particular slot, for a
+// plate over [Start, End). From Start a matching slot is held away from
+// walk-ins until the plate arrives or the grace period runs out.
+type Reservation struct {
+	ID       string
+	Lot      string
+	Plate    string
+	Size     VehicleSize
+	Slot     int `json:",omitempty"` // requested slot; 0 takes any slot the size fits
+	Start    time.Time
+	End      time.Time
+	Status   ReservationStatus
+	HeldSlot int   `json:",omitempty"`
+	Fee      Money `json:",omitzero"` // no-show fee charged
+}
+
+type ReservationRequest struct {
+	Plate      string
+	Size       VehicleSize
+	Slot       int
+	Start, End time.Time
+}
+
+// ReservationPricer is implemented by tariffs that charge for booking a
+// slot and for not turning up.
+type ReservationPricer interface {
+	ReservationFee(r Reservation) int
+	NoShowFee(r Reservation) int
+}
+
+func (t PerMinuteTariff) ReservationFee(Reservation) int { return t.ReservationCharge }
+func (t PerMinuteTariff) NoShowFee(Reservation) int      { return t.NoShowCharge }
+func (t RuleTariff) ReservationFee(Reservation) int      { return t.ReservationCharge }
+func (t RuleTariff) NoShowFee(Reservation) int           { return t.NoShowCharge }
+
+func (r *Reservation) active() bool {
+	return r.Status == ReservationBooked || r.Status == ReservationHeld
+}
+
+// open reports whether a walk-in may take the slot.
+func (s Slot) open() bool { return s.IsEmpty && s.HeldFor == "" }
+
+func (pl *ParkingLot) grace() time.Duration {
+	if pl.ReservationGrace > 0 {
+		return pl.ReservationGrace
+	}
+	return DefaultReservationGrace
+}
+
+// Reserve books a slot for the request's plate. Booking fails when every
+// slot the size fits, or the requested slot, is already booked for an
+// overlapping window.
+func (pl *ParkingLot) Reserve(req ReservationRequest) (r Reservation, err error) {
+	pl.update(func() {
+		if err = pl.sweepReservationsLocked(); err != nil {
+			err = pl.errorf(req.Plate, err)
+			return
+		}
+		var booked *Reservation
+		if booked, err = pl.bookLocked(req); err != nil {
+			return
+		}
+		mark := len(pl.pending)
+		pl.queueLocked(Event{Kind: EventReserved, Plate: booked.Plate, Slot: booked.Slot, Reservation: booked.ID})
+		err = pl.sweepReservationsLocked() // a window that has already started is held at once
+		if err == nil {
+			err = pl.persistLocked()
+		}
+		if err != nil {
+			pl.unholdLocked(booked)
+			pl.dropReservationLocked(booked.ID)
+			pl.pending = pl.pending[:mark]
+			err = pl.errorf(req.Plate, err)
+			return
+		}
+		r = *booked
+	})
+	return r, err
+}
+
+func (pl *ParkingLot) bookLocked(req ReservationRequest) (*Reservation, error) {
+	size, err := ParseVehicleSize(string(req.Size))
+	if err != nil {
+		return nil, pl.errorf(req.Plate, fmt.Errorf("%w: %v", ErrInvalidReservation, err))
+	}
+	switch {
+	case req.Plate == "":
+		return nil, pl.errorf("", fmt.Errorf("%w: no plate", ErrInvalidReservation))
+	case !req.End.After(req.Start):
+		return nil, pl.errorf(req.Plate, fmt.Errorf("%w: it must end after it starts", ErrInvalidReservation))
+	case !req.End.After(pl.now()):
+		return nil, pl.errorf(req.Plate, fmt.Errorf("%w: the window is already over", ErrInvalidReservation))
+	}
+
+	// Bookings for a particular slot take that slot; the others need one
+	// slot each of their class or larger.
+	var demand, supply [numSizeClasses]int
+	pinned := make(map[int]bool)
+	if req.Slot != 0 {
+		pinned[req.Slot] = true
+	} else {
+		demand[size.rank()]++
+	}
+	for _, other := range pl.reservations {
+		if !other.active() || !other.Start.Before(req.End) || !req.Start.Before(other.End) {
+			continue
+		}
+		if other.Plate == req.Plate {
+			return nil, pl.errorf(req.Plate, ErrReservationClash)
+		}
+		if req.Slot != 0 && other.Slot == req.Slot {
+			return nil, pl.errorf(req.Plate, fmt.Errorf("%w: slot %d is booked", ErrNoReservationSlot, req.Slot))
+		}
+		if other.Slot != 0 {
+			pinned[other.Slot] = true
+		} else {
+			demand[other.Size.rank()]++
+		}
+	}
+	for _, slot := range pl.Slots {
+		if req.Slot != 0 && slot.Number == req.Slot && !size.FitsIn(slot.Size) {
+			return nil, pl.errorf(req.Plate, fmt.Errorf("%w: slot %d does not fit a %s vehicle", ErrIncompatibleVehicle, req.Slot, size))
+		}
+		if !slot.Accessible && !pinned[slot.Number] {
+			supply[slotClass(slot.Size).rank()]++
+		}
+	}
+	if req.Slot != 0 && pl.slotIndexLocked(req.Slot) < 0 {
+		return nil, pl.errorf(req.Plate, fmt.Errorf("%w %d", ErrUnknownSlot, req.Slot))
+	}
+	// Every class and those above it must have slots for the bookings
+	// that only fit there.
+	needed, available := 0, 0
+	for r := numSizeClasses - 1; r >= 0; r-- {
+		needed += demand[r]
+		available += supply[r]
+		if needed > available {
+			return nil, pl.errorf(req.Plate, ErrNoReservationSlot)
+		}
+	}
+
+	r := &Reservation{
+		ID:     "R-" + newTicketID()[2:],
+		Lot:    pl.Name,
+		Plate:  req.Plate,
+		Size:   size,
+		Slot:   req.Slot,
+		Start:  req.Start,
+		End:    req.End,
+		Status: ReservationBooked,
+	}
+	pl.reservations = append(pl.reservations, r)
+	sort.SliceStable(pl.reservations, func(i, j int) bool { return pl.reservations[i].Start.Before(pl.reservations[j].Start) })
+	return r, nil
+}
+
+// CancelReservation frees the reservation's held slot, if any.
+func (pl *ParkingLot) CancelReservation(id string) error {
+	var err error
+	pl.update(func() {
+		r := pl.reservationLocked(id)
+		if r == nil || !r.active() {
+			err = &LotError{Lot: pl.Name, Err: fmt.Errorf("%w: %s", ErrUnknownReservation, id)}
+			return
+		}
+		pl.releaseHoldLocked(r)
+		r.Status = ReservationCancelled
+		err = pl.persistLocked()
+	})
+	return err
+}
+
+// Reservations lists the lot's reservations, earliest first.
+func (pl *ParkingLot) Reservations() []Reservation {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	list := make([]Reservation, len(pl.reservations))
+	for i, r := range pl.reservations {
+		list[i] = *r
+	}
+	return list
+}
+
+// SweepReservations holds slots for windows that have started and for
+// pass holders' dedicated slots, and expires no-shows. Parking and reserving sweep first, so a periodic call is only
+// needed to keep counts and no-show charges current on a quiet lot.
+func (pl *ParkingLot) SweepReservations() error {
+	var err error
+	pl.update(func() {
+		err = pl.sweepReservationsLocked()
+	})
+	return err
+}
+
+// sweepReservationsLocked holds and expires reservations as their windows
+// pass. If the no-show charges cannot be made durable the expired
+// reservations are booked again, to be charged on a later sweep.
+func (pl *ParkingLot) sweepReservationsLocked() error {
+	pl.sweepPassesLocked() // first, so a reservation never takes a dedicated slot
+	now := pl.now()
+	var entries []JournalEntry
+	var expired []*Reservation
+	mark := len(pl.pending)
+	for _, r := range pl.reservations {
+		if r.Status == ReservationBooked && !now.Before(r.Start) {
+			pl.holdLocked(r)
+		}
+		if r.active() && now.After(r.Start.Add(pl.grace())) {
+			pl.releaseHoldLocked(r)
+			r.Status = ReservationNoShow
+			var quote FeeQuote
+			if fee := pl.reservationPricesLocked(func(p ReservationPricer) int { return p.NoShowFee(*r) }); fee > 0 {
+				quote.add(LinePenalty, "No-show fee", Rupees(fee))
+				pl.Pricing.price(&quote)
+			}
+			r.Fee = quote.Total
+			expired = append(expired, r)
+			pl.queueLocked(Event{Kind: EventNoShow, Plate: r.Plate, Slot: r.HeldSlot, Fee: r.Fee, Reservation: r.ID})
+			if r.Fee.Amount > 0 {
+				entries = append(entries, JournalEntry{Kind: JournalCharged, Plate: r.Plate, Fee: r.Fee, Lines: quote.Lines})
+			}
+		}
+	}
+	if len(entries) > 0 {
+		if err := pl.commitLocked(entries...); err != nil {
+			for _, r := range expired {
+				r.Status, r.Fee = ReservationBooked, Money{}
+			}
+			kept := slices.DeleteFunc(pl.pending[mark:], func(e Event) bool { return e.Kind == EventNoShow })
+			pl.pending = pl.pending[:mark+len(kept)]
+			return err
+		}
+	}
+
+	kept := pl.reservations[:0]
+	for _, r := range pl.reservations {
+		if !r.active() && r.Status != ReservationFulfilled && now.After(r.End) {
+			continue // finished and past its window
+		}
+		kept = append(kept, r)
+	}
+	clear(pl.reservations[len(kept):])
+	pl.reservations = kept
+	return nil
+}
+
+func (pl *ParkingLot) reservationPricesLocked(price func(ReservationPricer) int) int {
+	tariff := pl.Tariff
+	if tariff == nil {
+		tariff = DefaultTariff
+	}
+	if p, ok := tariff.(ReservationPricer); ok {
+		return price(p)
+	}
+	return 0
+}
+
+func (pl *ParkingLot) reservationLocked(id string) *Reservation {
+	for _, r := range pl.reservations {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (pl *ParkingLot) dropReservationLocked(id string) {
+	for i, r := range pl.reservations {
+		if r.ID == id {
+			pl.reservations = append(pl.reservations[:i], pl.reservations[i+1:]...)
+			return
+		}
+	}
+}
+
+// holdLocked takes a free slot for the reservation out of walk-in use: the
+// requested slot, or the lowest non-accessible slot of the smallest class
+// the size fits, leaving larger slots to the bookings that need them.
+func (pl *ParkingLot) holdLocked(r *Reservation) {
+	idx := pl.indexLocked()
+	i := -1
+	if r.Slot != 0 {
+		if j := pl.slotIndexLocked(r.Slot); j >= 0 && pl.Slots[j].open() {
+			i = j
+		}
+	} else {
+		i = idx.smallestFree(pl.Slots, r.Size.rank())
+	}
+	if i < 0 {
+		return // retried on the next sweep, e.g. after a car leaves
+	}
+	pl.holdSlotLocked(i, r.ID)
+	r.HeldSlot = pl.Slots[i].Number
+	r.Status = ReservationHeld
+}
+
+// holdSlotLocked keeps the free slot at i for id, out of walk-in use.
+func (pl *ParkingLot) holdSlotLocked(i int, id string) {
+	idx := pl.indexLocked()
+	pl.Slots[i].HeldFor = id
+	idx.markTaken(pl.Slots, i)
+	if idx.total == 0 {
+		pl.queueLocked(Event{Kind: EventFull})
+	}
+}
+
+func (pl *ParkingLot) unholdSlotLocked(i int) {
+	idx := pl.indexLocked()
+	wasFull := idx.total == 0
+	pl.Slots[i].HeldFor = ""
+	idx.markFree(pl.Slots, i)
+	if wasFull {
+		pl.queueLocked(Event{Kind: EventAvailable})
+	}
+}
+
+func (pl *ParkingLot) unholdLocked(r *Reservation) {
+	if r.Status != ReservationHeld {
+		return
+	}
+	r.Status = ReservationBooked
+	i := pl.slotIndexLocked(r.HeldSlot)
+	r.HeldSlot = 0
+	if i >= 0 && pl.Slots[i].HeldFor == r.ID {
+		pl.unholdSlotLocked(i)
+	}
+}
+
+// releaseHoldLocked gives up the reservation's slot for good, to the pass
+// it is dedicated to if any and otherwise to walk-ins.
+func (pl *ParkingLot) releaseHoldLocked(r *Reservation) {
+	held := r.HeldSlot
+	pl.unholdLocked(r)
+	if i := pl.slotIndexLocked(held); held != 0 && i >= 0 && pl.holdForPassLocked(i) && pl.indexLocked().total == 0 {
+		pl.queueLocked(Event{Kind: EventFull})
+	}
+}
+
+// arrivalLocked returns the plate's reservation if the car is arriving
+// within the grace period either side of the window's start.
+func (pl *ParkingLot) arrivalLocked(plate string) *Reservation {
+	now := pl.now()
+	for _, r := range pl.reservations {
+		if r.Plate == plate && r.active() && !now.Before(r.Start.Add(-pl.grace())) && !now.After(r.Start.Add(pl.grace())) {
+			return r
+		}
+	}
+	return nil
+}
+
+// placeReservedLocked parks a car arriving for its reservation in the held
+// slot. It returns -1 when nothing is held or the car does not fit, and the
+// car then goes through normal placement.
+func (pl *ParkingLot) placeReservedLocked(r *Reservation, car *Car, attendantName string) int {
+	if r.Status == ReservationBooked {
+		pl.holdLocked(r)
+	}
+	if r.Status != ReservationHeld {
+		return -1
+	}
+	i := pl.slotIndexLocked(r.HeldSlot)
+	if !car.Size.FitsIn(pl.Slots[i].Size) {
+		pl.unholdLocked(r)
+		return -1
+	}
+	pl.unholdLocked(r)
+	pl.occupyLocked(i, 1, car, attendantName)
+	return pl.Slots[i].Number
+}
+
+// HasReservation reports whether the plate may arrive now for one of the
+// lot's reservations.
+func (pl *ParkingLot) HasReservation(plate string) bool {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	return pl.arrivalLocked(plate) != nil
+}
+
+// Reserve books in the named lot, or without a name in the first lot, by
+// most free room for the size, that can take the booking.
+func (pm *ParkingManager) Reserve(lotName string, req ReservationRequest) (Reservation, error) {
+	if lotName != "" {
+		lot, err := pm.Lot(lotName)
+		if err != nil {
+			return Reservation{}, err
+		}
+		return lot.Reserve(req)
+	}
+	lots := pm.lots()
+	sort.SliceStable(lots, func(i, j int) bool { return lots[i].FreeSlotsFor(req.Size) > lots[j].FreeSlotsFor(req.Size) })
+	err := error(&LotError{Plate: req.Plate, Err: ErrNoReservationSlot})
+	for _, lot := range lots {
+		var r Reservation
+		if r, err = lot.Reserve(req); err == nil || !errors.Is(err, ErrNoReservationSlot) {
+			return r, err
+		}
+	}
+	return Reservation{}, err
+}
@@ -0,0 +1,223 @@
+// reservation_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func reservedLot(t *testing.T, slots int) (*ParkingLot, *FakeClock) {
+	t.Helper()
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	lot := NewParkingLot("Lot A", slots)
+	lot.SetClock(clock)
+	lot.SetTariff(PerMinuteTariff{RatePerMinute: 2, MinimumMinutes: 1, ReservationCharge: 50, NoShowCharge: 100})
+	return lot, clock
+}
+
+func TestReservationHoldsSlotAndIsHonoredOnArrival(t *testing.T) {
+	lot, clock := reservedLot(t, 2)
+	start := clock.Now().Add(time.Hour)
+	r, err := lot.Reserve(ReservationRequest{Plate: "RS1", Start: start, End: start.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != ReservationBooked {
+		t.Fatalf("expected a future booking to wait, got %+v", r)
+	}
+
+	// Before the window walk-ins may use every slot.
+	if _, err := lot.ParkCar(&Car{Number: "W1"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if _, err := lot.ParkCar(&Car{Number: "W2"}); !errors.Is(err, ErrLotFull) {
+		t.Fatalf("expected the held slot to be refused to a walk-in, got %v", err)
+	}
+	if free := lot.FreeSlots(); free != 0 {
+		t.Errorf("expected the held slot to count as taken, got %d free", free)
+	}
+
+	restored := LotFromSnapshot(lot.Snapshot())
+	if held := restored.Reservations(); len(held) != 1 || held[0].Status != ReservationHeld || held[0].HeldSlot != 2 {
+		t.Errorf("expected the hold to survive a snapshot, got %+v", held)
+	}
+
+	clock.Advance(5 * time.Minute)
+	slot, err := lot.ParkCar(&Car{Number: "RS1"})
+	if err != nil || slot != 2 {
+		t.Fatalf("expected RS1 in its held slot 2, got %d (err %v)", slot, err)
+	}
+	if got := lot.Reservations(); got[0].Status != ReservationFulfilled {
+		t.Errorf("expected the reservation to be fulfilled, got %+v", got[0])
+	}
+
+	clock.Advance(10 * time.Minute)
+	_, quote, err := lot.UnparkCarWithQuote("RS1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Total != Rupees(20+50) || quote.Lines[len(quote.Lines)-1].Description != "Reservation fee" {
+		t.Errorf("expected parking plus the reservation fee, got %+v", quote)
+	}
+	if got := lot.Reservations(); len(got) != 0 {
+		t.Errorf("expected the used reservation to be dropped, got %+v", got)
+	}
+}
+
+func TestReservationNoShowIsChargedAndReleased(t *testing.T) {
+	lot, clock := reservedLot(t, 1)
+	events := recordEvents(lot)
+	r, err := lot.Reserve(ReservationRequest{Plate: "NS1", Start: clock.Now(), End: clock.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != ReservationHeld {
+		t.Fatalf("expected a started window to hold at once, got %+v", r)
+	}
+	if _, err := lot.ParkCar(&Car{Number: "W1"}); !errors.Is(err, ErrLotFull) {
+		t.Fatalf("expected the walk-in to be refused, got %v", err)
+	}
+
+	clock.Advance(DefaultReservationGrace + time.Minute)
+	if err := lot.SweepReservations(); err != nil {
+		t.Fatal(err)
+	}
+	if got := lot.Reservations(); got[0].Status != ReservationNoShow || got[0].Fee != Rupees(100) {
+		t.Errorf("expected a charged no-show, got %+v", got[0])
+	}
+	lot.flushObservers()
+	var noShow *Event
+	for _, e := range *events {
+		if e.Kind == EventNoShow {
+			noShow = &e
+		}
+	}
+	if noShow == nil || noShow.Fee != Rupees(100) || noShow.Reservation != r.ID {
+		t.Errorf("expected a no_show event for %s, got %+v", r.ID, *events)
+	}
+	if _, err := lot.ParkCar(&Car{Number: "W1"}); err != nil {
+		t.Errorf("expected the released slot to take a walk-in: %v", err)
+	}
+	if _, err := lot.ParkCar(&Car{Number: "NS1"}); !errors.Is(err, ErrLotFull) {
+		t.Errorf("expected the late plate to be treated as a walk-in, got %v", err)
+	}
+}
+
+func TestReservationBookingLimits(t *testing.T) {
+	lot, clock := reservedLot(t, 2)
+	lot.Slots[1].Size = SizeCompact
+	at := clock.Now().Add(time.Hour)
+	window := func(plate string, size VehicleSize, slot int, from time.Time) ReservationRequest {
+		return ReservationRequest{Plate: plate, Size: size, Slot: slot, Start: from, End: from.Add(time.Hour)}
+	}
+
+	if _, err := lot.Reserve(window("B1", SizeLarge, 0, at)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lot.Reserve(window("B2", SizeLarge, 0, at.Add(30*time.Minute))); !errors.Is(err, ErrNoReservationSlot) {
+		t.Errorf("expected the only large slot to be booked, got %v", err)
+	}
+	if _, err := lot.Reserve(window("B2", SizeLarge, 0, at.Add(time.Hour))); err != nil {
+		t.Errorf("expected a later window to book: %v", err)
+	}
+	if _, err := lot.Reserve(window("B1", SizeCompact, 0, at)); !errors.Is(err, ErrReservationClash) {
+		t.Errorf("expected a clash for the same plate, got %v", err)
+	}
+	if _, err := lot.Reserve(window("B3", SizeLarge, 2, at.Add(3*time.Hour))); !errors.Is(err, ErrIncompatibleVehicle) {
+		t.Errorf("expected a large vehicle to be refused the compact slot, got %v", err)
+	}
+	if _, err := lot.Reserve(window("B3", SizeCompact, 9, at)); !errors.Is(err, ErrUnknownSlot) {
+		t.Errorf("expected an unknown slot, got %v", err)
+	}
+	c, err := lot.Reserve(window("B4", SizeCompact, 2, at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lot.CancelReservation(c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := lot.CancelReservation(c.ID); !errors.Is(err, ErrUnknownReservation) {
+		t.Errorf("expected a second cancel to fail, got %v", err)
+	}
+}
+
+func TestReservationsShareSlotsBySizeClass(t *testing.T) {
+	lot, clock := reservedLot(t, 2)
+	lot.Slots[1].Size = SizeCompact
+	at := clock.Now().Add(time.Hour)
+	window := func(plate string, size VehicleSize) ReservationRequest {
+		return ReservationRequest{Plate: plate, Size: size, Start: at, End: at.Add(time.Hour)}
+	}
+
+	compact, err := lot.Reserve(window("SC1", SizeCompact))
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := lot.Reserve(window("SC2", SizeLarge))
+	if err != nil {
+		t.Fatalf("expected the large slot left for a large booking: %v", err)
+	}
+	if _, err := lot.Reserve(window("SC3", SizeMotorcycle)); !errors.Is(err, ErrNoReservationSlot) {
+		t.Errorf("expected both slots booked, got %v", err)
+	}
+
+	// The compact booking is held in the compact slot, not the lower large one.
+	clock.Set(at)
+	if err := lot.SweepReservations(); err != nil {
+		t.Fatal(err)
+	}
+	held := make(map[string]int)
+	for _, r := range lot.Reservations() {
+		held[r.ID] = r.HeldSlot
+	}
+	if held[compact.ID] != 2 || held[large.ID] != 1 {
+		t.Errorf("expected compact in slot 2 and large in slot 1, got %v", held)
+	}
+}
+
+func TestReservationSweepFailureIsReported(t *testing.T) {
+	lot, clock := reservedLot(t, 2)
+	store := &failingStore{}
+	if err := lot.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	r, err := lot.Reserve(ReservationRequest{Plate: "SF1", Start: clock.Now(), End: clock.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(DefaultReservationGrace + time.Minute)
+	store.fail = true
+	if _, err := lot.ParkCar(&Car{Number: "W1"}); err == nil {
+		t.Fatal("expected the failed no-show charge to stop the park")
+	}
+	if _, err := lot.Reserve(ReservationRequest{Plate: "SF2", Start: clock.Now(), End: clock.Now().Add(time.Hour)}); err == nil {
+		t.Fatal("expected the failed no-show charge to stop the booking")
+	}
+	if got := lot.Reservations(); len(got) != 1 || got[0].Status == ReservationNoShow || got[0].Fee.Amount != 0 {
+		t.Fatalf("expected the no-show left uncharged, got %+v", got)
+	}
+
+	store.fail = false
+	if err := lot.SweepReservations(); err != nil {
+		t.Fatal(err)
+	}
+	if got := lot.Reservations(); got[0].ID != r.ID || got[0].Status != ReservationNoShow || got[0].Fee != Rupees(100) {
+		t.Errorf("expected the no-show charged once the store recovers, got %+v", got[0])
+	}
+}
+
+func TestManagerSendsReservedPlateToItsLot(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	manager := NewParkingManager(NewParkingLot("Small", 1), NewParkingLot("Big", 3))
+	manager.SetClock(clock)
+	if _, err := manager.Reserve("Small", ReservationRequest{Plate: "MR1", Start: clock.Now(), End: clock.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	lotName, slot, err := manager.ParkEvenly(&Car{Number: "MR1"})
+	if err != nil || lotName != "Small" || slot != 1 {
+		t.Errorf("expected MR1 in its reserved slot in Small, got %s %d (err %v)", lotName, slot, err)
+	}
+}
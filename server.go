@@ -0,0 +1,512 @@
+// server.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Server exposes a ParkingManager over HTTP with JSON bodies. Lot-full and
+// duplicate-plate errors map to 409, unknown plates, lots and tickets to
+// 404, and bad input to 400 or 422.
+type Server struct {
+	Manager *ParkingManager
+	Journal string // journal file GET /reports reads; "" has no reports
+
+	mux    *http.ServeMux
+	stream *eventStream
+}
+
+func NewServer(manager *ParkingManager) *Server {
+	s := &Server{Manager: manager, mux: http.NewServeMux(), stream: newEventStream(manager.lots())}
+	s.mux.HandleFunc("GET /lots", s.listLots)
+	s.mux.HandleFunc("GET /lots/{lot}", s.lotStatus)
+	s.mux.HandleFunc("GET /lots/{lot}/cars", s.lotCars)
+	s.mux.HandleFunc("GET /lots/{lot}/quote", s.quote)
+	s.mux.HandleFunc("POST /lots/{lot}/park", s.parkInLot)
+	s.mux.HandleFunc("POST /lots/{lot}/unpark", s.unpark)
+	s.mux.HandleFunc("POST /lots/{lot}/charge", s.charge)
+	s.mux.HandleFunc("POST /park", s.parkAnywhere)
+	s.mux.HandleFunc("GET /cars", s.searchCars)
+	s.mux.HandleFunc("GET /cars/{plate}", s.findCar)
+	s.mux.HandleFunc("GET /events", s.streamEvents)
+	s.mux.HandleFunc("POST /reservations", s.reserve)
+	s.mux.HandleFunc("POST /lots/{lot}/reservations", s.reserve)
+	s.mux.HandleFunc("GET /lots/{lot}/reservations", s.listReservations)
+	s.mux.HandleFunc("DELETE /lots/{lot}/reservations/{id}", s.cancelReservation)
+	s.mux.HandleFunc("GET /passes", s.listPasses)
+	s.mux.HandleFunc("POST /passes", s.addPass)
+	s.mux.HandleFunc("DELETE /passes/{plate}", s.removePass)
+	s.mux.HandleFunc("GET /receipts", s.listReceipts)
+	s.mux.HandleFunc("GET /receipts/{ticket}", s.receipt)
+	s.mux.HandleFunc("POST /receipts/{ticket}/refund", s.refund)
+	s.mux.HandleFunc("GET /reports", s.report)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close stops following the lots' events. Lots added to the manager after
+// NewServer are served but not streamed.
+func (s *Server) Close() {
+	s.stream.close()
+}
+
+type parkRequest struct {
+	Car
+	Attendant string
+}
+
+type exitBody struct {
+	Plate  string
+	Ticket string
+	Lost   bool
+	Method PaymentMethod `json:",omitempty"` // pay before the slot is released; see PayAndUnpark
+}
+
+type parkResponse struct {
+	Lot    string
+	Slot   int
+	Ticket Ticket
+}
+
+type exitResponse struct {
+	Lot     string
+	Slot    int
+	Ticket  *Ticket   `json:",omitempty"`
+	Quote   *FeeQuote `json:",omitempty"`
+	Fee     Money
+	Receipt *Receipt `json:",omitempty"`
+}
+
+type carLocation struct {
+	Lot  string
+	Slot Slot
+}
+
+func (s *Server) listLots(w http.ResponseWriter, r *http.Request) {
+	statuses := []LotStatus{}
+	for _, lot := range s.Manager.lots() {
+		statuses = append(statuses, lot.Status())
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) lotStatus(w http.ResponseWriter, r *http.Request) {
+	lot, err := s.Manager.Lot(r.PathValue("lot"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lot.Status())
+}
+
+func (s *Server) lotCars(w http.ResponseWriter, r *http.Request) {
+	lot, err := s.Manager.Lot(r.PathValue("lot"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	cars := lot.GetAllParkedCars()
+	if cars == nil {
+		cars = []CarWithAttendant{}
+	}
+	writeJSON(w, http.StatusOK, cars)
+}
+
+func (s *Server) quote(w http.ResponseWriter, r *http.Request) {
+	lot, err := s.Manager.Lot(r.PathValue("lot"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	quote, err := lot.QuoteFee(r.URL.Query().Get("plate"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, quote)
+}
+
+func (s *Server) parkInLot(w http.ResponseWriter, r *http.Request) {
+	lot, err := s.Manager.Lot(r.PathValue("lot"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	car, attendant, ok := decodeCar(w, r)
+	if !ok {
+		return
+	}
+	ticket, err := (&Attendant{Name: attendant, Lot: lot}).ParkCarWithTicket(car)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, parkResponse{Lot: lot.Name, Slot: ticket.Slot, Ticket: ticket})
+}
+
+// parkAnywhere parks in the managed lot with the most room for the car's
+// size, as ParkEvenly does.
+func (s *Server) parkAnywhere(w http.ResponseWriter, r *http.Request) {
+	car, attendant, ok := decodeCar(w, r)
+	if !ok {
+		return
+	}
+	lotName, slot, err := s.Manager.ParkEvenlyWithAttendant(car, attendant)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp := parkResponse{Lot: lotName, Slot: slot}
+	if lot, err := s.Manager.Lot(lotName); err == nil {
+		resp.Ticket, _ = lot.TicketFor(car.Number)
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) unpark(w http.ResponseWriter, r *http.Request) {
+	lot, body, ok := s.decodeExit(w, r)
+	if !ok {
+		return
+	}
+	if body.Plate == "" {
+		writeError(w, badRequest("plate is required"))
+		return
+	}
+	slot, err := lot.UnparkCar(body.Plate)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, exitResponse{Lot: lot.Name, Slot: slot})
+}
+
+// charge checks a car out and bills it: by ticket when one is given, with
+// the lost-ticket penalty when Lost is set, and by plate otherwise. With a
+// Method the fee is paid first and the car only leaves if that succeeds.
+func (s *Server) charge(w http.ResponseWriter, r *http.Request) {
+	lot, body, ok := s.decodeExit(w, r)
+	if !ok {
+		return
+	}
+	resp, err := chargeExit(lot, body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func chargeExit(lot *ParkingLot, body exitBody) (exitResponse, error) {
+	var (
+		ticket Ticket
+		quote  FeeQuote
+		err    error
+	)
+	switch {
+	case body.Method != "" && (body.Ticket != "" || body.Plate != ""):
+		receipt, err := lot.PayAndUnpark(ExitPayment{Plate: body.Plate, Ticket: body.Ticket, Lost: body.Lost, Method: body.Method})
+		if err != nil {
+			return exitResponse{}, err
+		}
+		return exitResponse{Lot: lot.Name, Slot: receipt.Ticket.Slot, Ticket: &receipt.Ticket, Quote: &receipt.Quote,
+			Fee: receipt.Quote.Total, Receipt: &receipt}, nil
+	case body.Ticket != "":
+		ticket, quote, err = lot.UnparkByTicket(body.Ticket, body.Plate)
+	case body.Plate == "":
+		err = badRequest("plate or ticket is required")
+	case body.Lost:
+		ticket, quote, err = lot.UnparkLostTicket(body.Plate)
+	default:
+		ticket, quote, err = lot.unpark(exitRequest{plate: body.Plate, charge: true})
+	}
+	if err != nil {
+		return exitResponse{}, err
+	}
+	return exitResponse{Lot: lot.Name, Slot: ticket.Slot, Ticket: &ticket, Quote: &quote, Fee: quote.Total}, nil
+}
+
+func (s *Server) findCar(w http.ResponseWriter, r *http.Request) {
+	lotName, slot, err := s.Manager.FindCar(r.PathValue("plate"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, carLocation{Lot: lotName, Slot: *slot})
+}
+
+// searchCars takes the CarFilter fields as query parameters (color, make,
+// size, handicap) plus within, a duration such as 30m.
+func (s *Server) searchCars(w http.ResponseWriter, r *http.Request) {
+	cars, err := s.Manager.search(r.URL.Query().Get)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cars)
+}
+
+// search runs FindCars with a filter read from named parameters, shared by
+// the API's query string and the CLI's search flags.
+func (pm *ParkingManager) search(param func(string) string) ([]CarWithAttendant, error) {
+	filter := CarFilter{Color: param("color"), Make: param("make")}
+	if v := param("size"); v != "" {
+		size, err := ParseVehicleSize(v)
+		if err != nil {
+			return nil, badRequest(err.Error())
+		}
+		filter.Size = size
+	}
+	if v := param("handicap"); v != "" {
+		handicap, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, badRequest("handicap must be true or false")
+		}
+		filter.IsHandicap = &handicap
+	}
+
+	cars := pm.FindCars(filter)
+	if v := param("within"); v != "" {
+		within, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, badRequest("within must be a duration such as 30m")
+		}
+		cutoff := pm.now().Add(-within)
+		recent := cars[:0]
+		for _, car := range cars {
+			if car.ParkedAt.After(cutoff) {
+				recent = append(recent, car)
+			}
+		}
+		cars = recent
+	}
+	if cars == nil {
+		cars = []CarWithAttendant{}
+	}
+	return cars, nil
+}
+
+// reserve books in the lot named in the path, or in any lot with room.
+func (s *Server) reserve(w http.ResponseWriter, r *http.Request) {
+	var req ReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, badRequest("invalid JSON body: "+err.Error()))
+		return
+	}
+	reservation, err := s.Manager.Reserve(r.PathValue("lot"), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, reservation)
+}
+
+func (s *Server) listReservations(w http.ResponseWriter, r *http.Request) {
+	lot, err := s.Manager.Lot(r.PathValue("lot"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lot.Reservations())
+}
+
+func (s *Server) cancelReservation(w http.ResponseWriter, r *http.Request) {
+	lot, err := s.Manager.Lot(r.PathValue("lot"))
+	if err == nil {
+		err = lot.CancelReservation(r.PathValue("id"))
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listPasses(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Manager.ListPasses())
+}
+
+// addPass registers a pass, or replaces the plate's current one.
+func (s *Server) addPass(w http.ResponseWriter, r *http.Request) {
+	var p Pass
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeError(w, badRequest("invalid JSON body: "+err.Error()))
+		return
+	}
+	p, err := s.Manager.AddPass(p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (s *Server) removePass(w http.ResponseWriter, r *http.Request) {
+	if err := s.Manager.RemovePass(r.PathValue("plate")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listReceipts takes the plate as a query parameter.
+func (s *Server) listReceipts(w http.ResponseWriter, r *http.Request) {
+	plate := r.URL.Query().Get("plate")
+	if plate == "" {
+		writeError(w, badRequest("plate is required"))
+		return
+	}
+	receipts, err := s.Manager.ReceiptsFor(plate)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, receipts)
+}
+
+func (s *Server) receipt(w http.ResponseWriter, r *http.Request) {
+	receipt, err := s.Manager.Receipt(r.PathValue("ticket"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, receipt)
+}
+
+type refundRequest struct {
+	Amount Money // zero refunds everything not yet refunded
+	Reason string
+}
+
+func (s *Server) refund(w http.ResponseWriter, r *http.Request) {
+	var req refundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, badRequest("invalid JSON body: "+err.Error()))
+		return
+	}
+	receipt, err := s.Manager.RefundTicket(r.PathValue("ticket"), req.Amount, req.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, receipt)
+}
+
+func decodeCar(w http.ResponseWriter, r *http.Request) (*Car, string, bool) {
+	var req parkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, badRequest("invalid JSON body: "+err.Error()))
+		return nil, "", false
+	}
+	if req.Number == "" {
+		writeError(w, badRequest("Number is required"))
+		return nil, "", false
+	}
+	size, err := ParseVehicleSize(string(req.Size))
+	if err != nil {
+		writeError(w, badRequest(err.Error()))
+		return nil, "", false
+	}
+	car := req.Car
+	car.Size = size
+	car.ParkedAt = time.Time{}
+	return &car, req.Attendant, true
+}
+
+func (s *Server) decodeExit(w http.ResponseWriter, r *http.Request) (*ParkingLot, exitBody, bool) {
+	var body exitBody
+	lot, err := s.Manager.Lot(r.PathValue("lot"))
+	if err != nil {
+		writeError(w, err)
+		return nil, body, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, badRequest("invalid JSON body: "+err.Error()))
+		return nil, body, false
+	}
+	return lot, body, true
+}
+
+type requestError struct{ msg string }
+
+func (e *requestError) Error() string { return e.msg }
+
+func badRequest(msg string) error { return &requestError{msg} }
+
+// report takes the days as from and to, YYYY-MM-DD, and answers JSON or,
+// with format=csv, the table named by table.
+func (s *Server) report(w http.ResponseWriter, r *http.Request) {
+	if s.Journal == "" {
+		writeError(w, ErrNoJournal)
+		return
+	}
+	q := r.URL.Query()
+	from, to, err := ParseReportRange(q.Get("from"), q.Get("to"), s.Manager.now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	report, err := ReportFile(s.Journal, from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch q.Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, report)
+	case "csv":
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf, q.Get("table")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write(buf.Bytes())
+	default:
+		writeError(w, badRequest("format must be json or csv"))
+	}
+}
+
+// statusFor maps the lot's sentinel errors to HTTP status codes.
+func statusFor(err error) int {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr), errors.Is(err, ErrInvalidReservation), errors.Is(err, ErrInvalidPass),
+		errors.Is(err, ErrPaymentMethod):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPaymentDeclined):
+		return http.StatusPaymentRequired
+	case errors.Is(err, ErrCarNotFound), errors.Is(err, ErrUnknownLot), errors.Is(err, ErrInvalidTicket),
+		errors.Is(err, ErrUnknownReservation), errors.Is(err, ErrUnknownPass), errors.Is(err, ErrUnknownSlot),
+		errors.Is(err, ErrNoReceipt), errors.Is(err, ErrNoJournal):
+		return http.StatusNotFound
+	case errors.Is(err, ErrLotFull), errors.Is(err, ErrAccessibleOnly), errors.Is(err, ErrNoSlotOffered),
+		errors.Is(err, ErrDuplicatePlate), errors.Is(err, ErrTicketUsed), errors.Is(err, ErrLotExists),
+		errors.Is(err, ErrNoReservationSlot), errors.Is(err, ErrReservationClash), errors.Is(err, ErrPaymentPending),
+		errors.Is(err, ErrRefundExceeds):
+		return http.StatusConflict
+	case errors.Is(err, ErrIncompatibleVehicle), errors.Is(err, ErrTicketMismatch), errors.Is(err, ErrMixedCurrencies):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, statusFor(err), map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
@@ -0,0 +1,98 @@
+// server_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, handler http.Handler, method, path, body string, want int, out any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != want {
+		t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, want, rec.Code, rec.Body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+func TestServerParkFindAndCharge(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	manager := NewParkingManager(NewParkingLot("Lot A", 2), NewParkingLot("Lot B", 1))
+	manager.SetClock(clock)
+	server := NewServer(manager)
+	t.Cleanup(server.Close)
+
+	var parked parkResponse
+	serve(t, server, "POST", "/lots/Lot%20A/park", `{"Number":"H1","Color":"White","Attendant":"Asha"}`, http.StatusCreated, &parked)
+	if parked.Lot != "Lot A" || parked.Slot != 1 || parked.Ticket.ID == "" || parked.Ticket.Attendant != "Asha" {
+		t.Fatalf("unexpected park response %+v", parked)
+	}
+	serve(t, server, "POST", "/park", `{"Number":"H2","Color":"Red","Attendant":"Ravi"}`, http.StatusCreated, &parked)
+	if parked.Lot != "Lot A" || parked.Ticket.ID == "" || parked.Ticket.Attendant != "Ravi" {
+		t.Errorf("expected H2 parked by Ravi in the roomier Lot A, got %+v", parked)
+	}
+
+	var found carLocation
+	serve(t, server, "GET", "/cars/H2", "", http.StatusOK, &found)
+	if found.Lot != "Lot A" || found.Slot.Number != 2 {
+		t.Errorf("unexpected location %+v", found)
+	}
+	var cars []CarWithAttendant
+	serve(t, server, "GET", "/cars?color=White", "", http.StatusOK, &cars)
+	if len(cars) != 1 || cars[0].Number != "H1" || cars[0].Attendant != "Asha" {
+		t.Errorf("unexpected search result %+v", cars)
+	}
+
+	var status LotStatus
+	serve(t, server, "GET", "/lots/Lot%20A", "", http.StatusOK, &status)
+	if status.Capacity != 2 || status.Occupied != 2 || !status.Full {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	clock.Advance(15 * time.Minute)
+	var charged exitResponse
+	serve(t, server, "POST", "/lots/Lot%20A/charge", `{"Plate":"H1"}`, http.StatusOK, &charged)
+	if charged.Slot != 1 || charged.Fee != Rupees(30) || charged.Quote == nil {
+		t.Errorf("unexpected charge response %+v", charged)
+	}
+
+	var lots []LotStatus
+	serve(t, server, "GET", "/lots", "", http.StatusOK, &lots)
+	if len(lots) != 2 || lots[0].Free != 1 || lots[1].Free != 1 {
+		t.Errorf("unexpected lot listing %+v", lots)
+	}
+}
+
+func TestServerMapsErrorsToStatusCodes(t *testing.T) {
+	manager := NewParkingManager(NewParkingLot("Lot A", 1))
+	server := NewServer(manager)
+	t.Cleanup(server.Close)
+
+	serve(t, server, "POST", "/lots/Lot%20A/park", `{"Number":"E1"}`, http.StatusCreated, nil)
+	serve(t, server, "POST", "/lots/Lot%20A/park", `{"Number":"E2"}`, http.StatusConflict, nil)
+	serve(t, server, "POST", "/park", `{"Number":"E1"}`, http.StatusConflict, nil)
+	serve(t, server, "POST", "/park", `{"Number":"E4","Size":"bus"}`, http.StatusUnprocessableEntity, nil)
+	serve(t, server, "POST", "/lots/Lot%20A/park", `{"Number":"E3","Size":"hovercraft"}`, http.StatusBadRequest, nil)
+	serve(t, server, "POST", "/lots/Lot%20A/park", `not json`, http.StatusBadRequest, nil)
+	serve(t, server, "POST", "/lots/Lot%20Z/park", `{"Number":"E3"}`, http.StatusNotFound, nil)
+	serve(t, server, "GET", "/cars/NOPE", "", http.StatusNotFound, nil)
+	serve(t, server, "POST", "/lots/Lot%20A/unpark", `{"Plate":"NOPE"}`, http.StatusNotFound, nil)
+	serve(t, server, "POST", "/lots/Lot%20A/charge", `{"Ticket":"T-bogus"}`, http.StatusNotFound, nil)
+
+	var body map[string]string
+	serve(t, server, "POST", "/lots/Lot%20A/unpark", `{"Plate":"E1"}`, http.StatusOK, nil)
+	serve(t, server, "POST", "/lots/Lot%20A/unpark", `{"Plate":"E1"}`, http.StatusNotFound, &body)
+	if !strings.Contains(body["error"], "car not found") {
+		t.Errorf("expected error message in body, got %v", body)
+	}
+}
@@ -0,0 +1,402 @@
+// store.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrPersist    = errors.New("could not persist lot state")
+	ErrNoSnapshot = errors.New("no saved state for lot")
+)
+
+// LotSnapshot is everything needed to rebuild a lot's layout and the cars
+// parked in it, including each car's ParkedAt so fees survive a restart.
+type LotSnapshot struct {
+	Name         string
+	BusSpan      int
+	Slots        []Slot
+	Reservations []Reservation `json:",omitempty"`
+}
+
+// Store persists lot snapshots. A lot with a Store writes through on every
+// park and unpark; if the write fails the change is rolled back.
+type Store interface {
+	SaveLot(snapshot LotSnapshot) error
+	LoadLot(name string) (LotSnapshot, error)
+	LotNames() ([]string, error)
+}
+
+// FileStore keeps one JSON file per lot in Dir, replaced atomically on
+// every save.
+type FileStore struct {
+	Dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (s *FileStore) path(name string) string {
+	return filepath.Join(s.Dir, url.PathEscape(name)+".json")
+}
+
+func (s *FileStore) SaveLot(snapshot LotSnapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(s.path(snapshot.Name), data)
+}
+
+// replaceFile writes data to a temporary file beside path and renames it
+// into place, so readers see the old or the new contents, never a mix.
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) LoadLot(name string) (LotSnapshot, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return LotSnapshot{}, fmt.Errorf("%w %q", ErrNoSnapshot, name)
+	}
+	if err != nil {
+		return LotSnapshot{}, err
+	}
+	var snapshot LotSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return LotSnapshot{}, fmt.Errorf("lot %q: %w", name, err)
+	}
+	return snapshot, nil
+}
+
+func (s *FileStore) LotNames() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(file, ".") || !strings.HasSuffix(file, ".json") {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(file, ".json"))
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// closedPath is where FileStore keeps a lot's used tickets: one JSON line
+// per ticket, appended as they close, in Dir/closed.
+func (s *FileStore) closedPath(lot string) string {
+	return filepath.Join(s.Dir, "closed", url.PathEscape(lot)+".jsonl")
+}
+
+func (s *FileStore) SaveClosedTicket(lot string, ticket Ticket) error {
+	if err := os.MkdirAll(filepath.Join(s.Dir, "closed"), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.closedPath(lot), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ClosedTickets reads the lot's used tickets back, rewriting the file
+// without those that closed more than ClosedTicketRetention before the
+// latest. A line torn by a crash while appending is dropped.
+func (s *FileStore) ClosedTickets(lot string) ([]Ticket, error) {
+	data, err := os.ReadFile(s.closedPath(lot))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tickets []Ticket
+	lines := bytes.Split(data, []byte("\n"))
+	for n, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var t Ticket
+		if err := json.Unmarshal(line, &t); err != nil {
+			if n == len(lines)-1 {
+				break // torn
+			}
+			return nil, fmt.Errorf("%s:%d: %w", s.closedPath(lot), n+1, err)
+		}
+		tickets = append(tickets, t)
+	}
+	if len(tickets) == 0 {
+		return nil, nil
+	}
+	cutoff := tickets[len(tickets)-1].ExitTime.Add(-ClosedTicketRetention)
+	kept := slices.DeleteFunc(slices.Clone(tickets), func(t Ticket) bool { return t.ExitTime.Before(cutoff) })
+	if len(kept) < len(tickets) || !bytes.HasSuffix(data, []byte("\n")) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, t := range kept {
+			if err := enc.Encode(t); err != nil {
+				return nil, err
+			}
+		}
+		if err := replaceFile(s.closedPath(lot), buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
+
+// receiptPath is where FileStore keeps a ticket's receipt: one JSON file
+// per ticket in Dir/receipts.
+func (s *FileStore) receiptPath(ticketID string) string {
+	return filepath.Join(s.Dir, "receipts", url.PathEscape(ticketID)+".json")
+}
+
+func (s *FileStore) SaveReceipt(r Receipt) error {
+	if err := os.MkdirAll(filepath.Join(s.Dir, "receipts"), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(s.receiptPath(r.Ticket.ID), data)
+}
+
+func (s *FileStore) LoadReceipt(ticketID string) (Receipt, error) {
+	data, err := os.ReadFile(s.receiptPath(ticketID))
+	if errors.Is(err, os.ErrNotExist) {
+		return Receipt{}, fmt.Errorf("%w for ticket %s", ErrNoReceipt, ticketID)
+	}
+	if err != nil {
+		return Receipt{}, err
+	}
+	var r Receipt
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Receipt{}, fmt.Errorf("receipt %s: %w", ticketID, err)
+	}
+	return r, nil
+}
+
+func (s *FileStore) ReceiptsFor(plate string) ([]Receipt, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, "receipts"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Receipt
+	for _, entry := range entries {
+		file := entry.Name()
+		if strings.HasPrefix(file, ".") || !strings.HasSuffix(file, ".json") {
+			continue
+		}
+		id, err := url.PathUnescape(strings.TrimSuffix(file, ".json"))
+		if err != nil {
+			continue
+		}
+		r, err := s.LoadReceipt(id)
+		if err != nil {
+			return nil, err
+		}
+		if r.Ticket.Plate == plate {
+			list = append(list, r)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Ticket.EntryTime.Before(list[j].Ticket.EntryTime) })
+	return list, nil
+}
+
+func (pl *ParkingLot) Snapshot() LotSnapshot {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	return pl.snapshotLocked()
+}
+
+func (pl *ParkingLot) snapshotLocked() LotSnapshot {
+	slots := make([]Slot, len(pl.Slots))
+	for i, slot := range pl.Slots {
+		if slot.Car != nil {
+			car := *slot.Car
+			slot.Car = &car
+		}
+		slots[i] = slot
+	}
+	var reservations []Reservation
+	for _, r := range pl.reservations {
+		reservations = append(reservations, *r)
+	}
+	return LotSnapshot{Name: pl.Name, BusSpan: pl.BusSpan, Slots: slots, Reservations: reservations}
+}
+
+func (pl *ParkingLot) persistLocked() error {
+	if pl.Store == nil {
+		return nil
+	}
+	if err := pl.Store.SaveLot(pl.snapshotLocked()); err != nil {
+		return fmt.Errorf("%w: %v", ErrPersist, err)
+	}
+	return nil
+}
+
+// SetStore attaches the store and saves the lot's current state to it.
+func (pl *ParkingLot) SetStore(store Store) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.Store = store
+	return pl.persistLocked()
+}
+
+// LotFromSnapshot rebuilds a lot. Slots spanned by one bus share a single
+// Car again, as they did before the snapshot was taken.
+func LotFromSnapshot(snapshot LotSnapshot) *ParkingLot {
+	slots := append([]Slot(nil), snapshot.Slots...)
+	heads := make(map[int]*Car)
+	for i := range slots {
+		if slots[i].IsEmpty {
+			slots[i].Car = nil
+			continue
+		}
+		if slots[i].SpanHead == 0 {
+			heads[slots[i].Number] = slots[i].Car
+		} else if car, ok := heads[slots[i].SpanHead]; ok {
+			slots[i].Car = car
+		}
+	}
+	lot := &ParkingLot{Name: snapshot.Name, Slots: slots, BusSpan: snapshot.BusSpan}
+	for _, r := range snapshot.Reservations {
+		lot.reservations = append(lot.reservations, &r)
+	}
+	return lot
+}
+
+// LoadParkingLot rebuilds the named lot from the store and keeps writing
+// through to it.
+func LoadParkingLot(store Store, name string) (*ParkingLot, error) {
+	snapshot, err := store.LoadLot(name)
+	if err != nil {
+		return nil, err
+	}
+	lot := LotFromSnapshot(snapshot)
+	lot.Store = store
+	if cs, ok := store.(ClosedTicketStore); ok {
+		closed, err := cs.ClosedTickets(name)
+		if err != nil {
+			return nil, err
+		}
+		issued := make(map[string]bool)
+		for _, slot := range lot.Slots {
+			issued[slot.TicketID] = true
+		}
+		for _, t := range closed {
+			if !issued[t.ID] { // saved before an exit that then failed
+				lot.closeTicketLocked(t)
+			}
+		}
+	}
+	return lot, nil
+}
+
+// LoadParkingManager rebuilds a manager from every lot saved in the store.
+func LoadParkingManager(store Store) (*ParkingManager, error) {
+	names, err := store.LotNames()
+	if err != nil {
+		return nil, err
+	}
+	pm := NewParkingManager()
+	for _, name := range names {
+		lot, err := LoadParkingLot(store, name)
+		if err != nil {
+			return nil, err
+		}
+		pm.AddLot(lot)
+	}
+	return pm, nil
+}
+
+// SetStore attaches the store to every managed lot.
+func (pm *ParkingManager) SetStore(store Store) error {
+	for _, lot := range pm.lots() {
+		if err := lot.SetStore(store); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoParkLocked and undoUnparkLocked roll back a change the store refused
+// and drop the events it queued, so observers never hear about it.
+func (pl *ParkingLot) undoParkLocked(car *Car, mark int) {
+	pl.releaseLocked(pl.idx.byPlate[car.Number])
+	pl.pending = pl.pending[:mark]
+}
+
+func (pl *ParkingLot) undoUnparkLocked(i, span int, car *Car, attendantName, ticketID string, mark int) {
+	if isPassHold(pl.Slots[i].HeldFor) { // held again as the car left
+		pl.unholdSlotLocked(i)
+	}
+	pl.occupyLocked(i, span, car, attendantName)
+	pl.issueTicketLocked(i, ticketID)
+	delete(pl.closedTickets, ticketID)
+	if pl.plates != nil && pl.plates.claim(car.Number, pl) == nil {
+		pl.plates.setSlot(car.Number, pl, pl.Slots[i].Number)
+	}
+	pl.pending = pl.pending[:mark]
+}
+
+func (pl *ParkingLot) spanLocked(i int) int {
+	span := 1
+	for j := i + 1; j < len(pl.Slots) && pl.Slots[j].SpanHead == pl.Slots[i].Number; j++ {
+		span++
+	}
+	return span
+}
@@ -0,0 +1,131 @@
+// store_test.go
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+
+	lot := inOneRow(NewParkingLotWithSizes("Lot A/North", SizeRegular, SizeLarge, SizeLarge, SizeLarge))
+	lot.BusSpan = 2
+	lot.SetClock(clock)
+	if err := lot.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = lot.ParkCarWithAttendant(&Car{Number: "KA01ST0001", Color: "Red"}, "Nina")
+	_, _ = lot.ParkCar(&Car{Number: "BUS7", Size: SizeBus})
+
+	// Simulate a restart: rebuild the manager from disk only.
+	manager, err := LoadParkingManager(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manager.Lots) != 1 || manager.Lots[0].Name != "Lot A/North" {
+		t.Fatalf("expected one reloaded lot, got %+v", manager.Lots)
+	}
+	reloaded := manager.Lots[0]
+	reloaded.SetClock(clock)
+
+	slot, err := reloaded.FindCar("KA01ST0001")
+	if err != nil || slot.AttendantName != "Nina" || slot.Car.Color != "Red" {
+		t.Fatalf("expected car restored with attendant, got %+v (err %v)", slot, err)
+	}
+
+	clock.Advance(10 * time.Minute)
+	_, fee, err := reloaded.UnparkCarAndCharge("KA01ST0001")
+	if err != nil || fee != 20 {
+		t.Errorf("expected ₹20 for 10 minutes across the restart, got ₹%d (err %v)", fee, err)
+	}
+	if _, err := reloaded.UnparkCar("BUS7"); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.FreeSlots() != 4 {
+		t.Errorf("expected the bus to free both spanned slots, got %d free", reloaded.FreeSlots())
+	}
+
+	again, err := LoadParkingLot(store, "Lot A/North")
+	if err != nil || len(again.GetAllParkedCars()) != 0 {
+		t.Errorf("expected unparks to be written through, got %v (err %v)", again.GetAllParkedCars(), err)
+	}
+}
+
+type failingStore struct {
+	fail bool
+	MemoryStore
+}
+
+func (s *failingStore) SaveLot(snapshot LotSnapshot) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.SaveLot(snapshot)
+}
+
+// MemoryStore is a minimal in-memory Store for tests.
+type MemoryStore struct {
+	lots map[string]LotSnapshot
+}
+
+func (s *MemoryStore) SaveLot(snapshot LotSnapshot) error {
+	if s.lots == nil {
+		s.lots = make(map[string]LotSnapshot)
+	}
+	s.lots[snapshot.Name] = snapshot
+	return nil
+}
+
+func (s *MemoryStore) LoadLot(name string) (LotSnapshot, error) {
+	snapshot, ok := s.lots[name]
+	if !ok {
+		return LotSnapshot{}, ErrNoSnapshot
+	}
+	return snapshot, nil
+}
+
+func (s *MemoryStore) LotNames() ([]string, error) {
+	var names []string
+	for name := range s.lots {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func TestFailedWriteRollsBackParkAndUnpark(t *testing.T) {
+	store := &failingStore{}
+	lot := NewParkingLot("Lot A", 2)
+	_ = lot.SetStore(store)
+	events := recordEvents(lot)
+
+	_, _ = lot.ParkCar(&Car{Number: "KEEP"})
+	store.fail = true
+
+	if _, err := lot.ParkCar(&Car{Number: "LOST"}); !errors.Is(err, ErrPersist) {
+		t.Fatalf("expected ErrPersist, got %v", err)
+	}
+	if _, err := lot.FindCar("LOST"); err == nil {
+		t.Error("expected failed park to be rolled back")
+	}
+	if _, err := lot.UnparkCar("KEEP"); !errors.Is(err, ErrPersist) {
+		t.Fatalf("expected ErrPersist on unpark, got %v", err)
+	}
+	if slot, err := lot.FindCar("KEEP"); err != nil || slot.Number != 1 {
+		t.Errorf("expected KEEP back in slot 1, got %v (err %v)", slot, err)
+	}
+	lot.flushObservers()
+	if len(*events) != 1 {
+		t.Errorf("expected only the first park to be announced, got %v", eventKinds(*events))
+	}
+
+	store.fail = false
+	if _, err := lot.UnparkCar("KEEP"); err != nil {
+		t.Errorf("expected unpark to succeed once the store recovers, got %v", err)
+	}
+}
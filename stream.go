@@ -0,0 +1,199 @@
+// stream.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	streamHistory   = 1024 // events kept for clients resuming with Last-Event-ID
+	streamHeartbeat = 15 * time.Second
+)
+
+type streamEvent struct {
+	id    uint64
+	event Event
+}
+
+// eventStream numbers the events of every lot it is subscribed to and
+// keeps the most recent ones, so a display board that reconnects with
+// Last-Event-ID receives what it missed before the live feed resumes.
+// The numbering starts again with each stream, so SSE ids carry the
+// stream's epoch as well: "<epoch>-<n>".
+type eventStream struct {
+	mu      sync.Mutex
+	epoch   string
+	next    uint64
+	history []streamEvent // at most streamHistory, oldest first
+	wake    chan struct{} // closed and replaced on every event
+	subs    []*Subscription
+}
+
+func newEventStream(lots []*ParkingLot) *eventStream {
+	epoch := strconv.FormatInt(time.Now().UnixNano(), 36)
+	st := &eventStream{epoch: epoch, next: 1, wake: make(chan struct{})}
+	for _, lot := range lots {
+		// The stream only appends to memory, so blocking never stalls a gate
+		// for long and no event is lost to resuming clients.
+		st.subs = append(st.subs, lot.Subscribe(st, SubscribeOptions{Buffer: 256, Policy: OverflowBlock}))
+	}
+	return st
+}
+
+func (st *eventStream) OnEvent(e Event) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.history) == streamHistory {
+		st.history = append(st.history[:0], st.history[1:]...)
+	}
+	st.history = append(st.history, streamEvent{id: st.next, event: e})
+	st.next++
+	close(st.wake)
+	st.wake = make(chan struct{})
+}
+
+// since returns the kept events after id and a channel closed when more
+// arrive. gap reports that events after id have already been discarded.
+func (st *eventStream) since(id uint64) (events []streamEvent, wake <-chan struct{}, gap bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.history) > 0 && st.history[0].id > id+1 {
+		gap = true
+	}
+	for i, e := range st.history {
+		if e.id > id {
+			events = append(events, st.history[i:]...)
+			break
+		}
+	}
+	return events, st.wake, gap
+}
+
+func (st *eventStream) latest() uint64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.next - 1
+}
+
+func (st *eventStream) sseID(id uint64) string {
+	return st.epoch + "-" + strconv.FormatUint(id, 10)
+}
+
+// parseID returns the event number of an SSE id this stream issued. Ids
+// from before a restart, or in the old bare-number form, are not.
+func (st *eventStream) parseID(v string) (uint64, bool) {
+	epoch, n, ok := strings.Cut(v, "-")
+	if !ok || epoch != st.epoch {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(n, 10, 64)
+	return id, err == nil
+}
+
+func (st *eventStream) close() {
+	for _, s := range st.subs {
+		s.Unsubscribe()
+	}
+}
+
+// streamEvents serves GET /events as Server-Sent Events. Each park, unpark,
+// charge, full, available and rejected-park event is sent with its kind as
+// the SSE event name, a JSON Event as data (carrying the lot's occupancy)
+// and an id the client can send back as Last-Event-ID. A fresh client, or
+// one whose missed events are no longer kept or whose id is from before a
+// restart, first gets a "status" event per lot. Repeat ?lot= to follow only some lots.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	only := make(map[string]bool)
+	for _, name := range r.URL.Query()["lot"] {
+		if _, err := s.Manager.Lot(name); err != nil {
+			writeError(w, err)
+			return
+		}
+		only[name] = true
+	}
+	wanted := func(lot string) bool { return len(only) == 0 || only[lot] }
+
+	last := s.stream.latest()
+	resume := false
+	if id, ok := s.stream.parseID(r.Header.Get("Last-Event-ID")); ok && id <= last {
+		last, resume = id, true
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	fmt.Fprintf(w, "retry: 3000\n\n")
+
+	sendStatus := func() error {
+		for _, lot := range s.Manager.lots() {
+			if wanted(lot.Name) {
+				if err := writeSSE(w, "status", "", lot.Status()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	events, wake, gap := s.stream.since(last)
+	if !resume || gap {
+		if err := sendStatus(); err != nil {
+			return
+		}
+	}
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		for _, e := range events {
+			last = e.id
+			if !wanted(e.event.Lot) {
+				continue
+			}
+			if err := writeSSE(w, string(e.event.Kind), s.stream.sseID(e.id), e.event); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			events = nil
+			continue
+		case <-wake:
+		}
+		events, wake, gap = s.stream.since(last)
+		if gap {
+			if err := sendStatus(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event, id string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,141 @@
+// stream_test.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseMessage struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// readSSE opens the stream and returns a function yielding its messages.
+func readSSE(t *testing.T, url, lastID string) func() sseMessage {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	messages := make(chan sseMessage, 64)
+	go func() {
+		var msg sseMessage
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if msg.Event != "" {
+					messages <- msg
+				}
+				msg = sseMessage{}
+			case strings.HasPrefix(line, "id: "):
+				msg.ID = line[4:]
+			case strings.HasPrefix(line, "event: "):
+				msg.Event = line[7:]
+			case strings.HasPrefix(line, "data: "):
+				msg.Data = line[6:]
+			}
+		}
+		close(messages)
+	}()
+	return func() sseMessage {
+		t.Helper()
+		select {
+		case msg := <-messages:
+			return msg
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for a stream message")
+			return sseMessage{}
+		}
+	}
+}
+
+func TestStreamPushesOccupancyAndResumesFromLastEventID(t *testing.T) {
+	lotA, lotB := NewParkingLot("Lot A", 1), NewParkingLot("Lot B", 2)
+	server := NewServer(NewParkingManager(lotA, lotB))
+	t.Cleanup(server.Close)
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close) // runs after the streams' bodies are closed
+
+	next := readSSE(t, ts.URL+"/events?lot=Lot%20A", "")
+	var status LotStatus
+	if msg := next(); msg.Event != "status" || json.Unmarshal([]byte(msg.Data), &status) != nil || status.Name != "Lot A" {
+		t.Fatalf("expected Lot A status first, got %+v", msg)
+	}
+
+	_, _ = lotB.ParkCar(&Car{Number: "S0"}) // filtered out
+	_, _ = lotA.ParkCar(&Car{Number: "S1"})
+
+	parked := next()
+	var e Event
+	if parked.Event != "parked" || json.Unmarshal([]byte(parked.Data), &e) != nil ||
+		e.Plate != "S1" || e.Occupied != 1 || e.Capacity != 1 {
+		t.Fatalf("expected parked event for S1, got %+v", parked)
+	}
+	if msg := next(); msg.Event != "full" {
+		t.Fatalf("expected full event, got %+v", msg)
+	}
+
+	// A board that dropped after the park event catches up on reconnect.
+	_, _ = lotA.UnparkCar("S1")
+	resumed := readSSE(t, ts.URL+"/events?lot=Lot%20A", parked.ID)
+	for _, want := range []string{"full", "unparked", "available"} {
+		if msg := resumed(); msg.Event != want {
+			t.Fatalf("expected %s on resume, got %+v", want, msg)
+		}
+	}
+}
+
+func TestStreamLastEventIDFromBeforeRestart(t *testing.T) {
+	before := NewServer(NewParkingManager(NewParkingLot("Lot A", 2)))
+	_, _ = before.Manager.Lots[0].ParkCar(&Car{Number: "S0"})
+	before.Close()
+	oldID := before.stream.sseID(before.stream.latest())
+
+	lot := NewParkingLot("Lot A", 4)
+	server := NewServer(NewParkingManager(lot))
+	t.Cleanup(server.Close)
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	// This server has already numbered past the old id.
+	_, _ = lot.ParkCar(&Car{Number: "S1"})
+	_, _ = lot.ParkCar(&Car{Number: "S2"})
+
+	for _, lastID := range []string{oldID, "5000", "garbage"} {
+		next := readSSE(t, ts.URL+"/events", lastID)
+		if msg := next(); msg.Event != "status" {
+			t.Fatalf("%s: expected status for a board resuming across a restart, got %+v", lastID, msg)
+		}
+	}
+	next := readSSE(t, ts.URL+"/events", oldID)
+	if msg := next(); msg.Event != "status" {
+		t.Fatalf("expected status first, got %+v", msg)
+	}
+	_, _ = lot.ParkCar(&Car{Number: "S3"})
+	if msg := next(); msg.Event != "parked" || msg.ID != server.stream.sseID(3) || msg.ID == oldID {
+		t.Fatalf("expected the live feed to resume with this server's ids, got %+v", msg)
+	}
+}
+
+func TestStreamRejectsUnknownLot(t *testing.T) {
+	server := NewServer(NewParkingManager(NewParkingLot("Lot A", 1)))
+	defer server.Close()
+	serve(t, server, "GET", "/events?lot=Nope", "", http.StatusNotFound, nil)
+}
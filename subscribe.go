@@ -0,0 +1,174 @@
+// subscribe.go
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy says what happens when a subscriber's queue is full.
+type OverflowPolicy int
+
+const (
+	OverflowDropNewest OverflowPolicy = iota // discard the event being delivered
+	OverflowDropOldest                       // discard the oldest queued event to make room
+	OverflowBlock                            // wait for room, stalling the lot's caller
+)
+
+const defaultSubscriberBuffer = 64
+
+type SubscribeOptions struct {
+	Buffer  int // queue length; 0 means 64
+	Policy  OverflowPolicy
+	OnPanic func(recovered any, e Event) // nil logs the panic
+}
+
+// Subscription delivers a lot's events to one observer from its own
+// goroutine, so a slow or failing observer never holds up a gate.
+type Subscription struct {
+	lot      *ParkingLot
+	observer EventObserver
+	opts     SubscribeOptions
+	queue    chan Event
+	done     chan struct{}
+	exited   chan struct{}
+	once     sync.Once
+	dropped  atomic.Uint64
+}
+
+func (pl *ParkingLot) Subscribe(observer EventObserver, opts SubscribeOptions) *Subscription {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.subscribeLocked(observer, opts)
+}
+
+func (pl *ParkingLot) subscribeLocked(observer EventObserver, opts SubscribeOptions) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultSubscriberBuffer
+	}
+	s := &Subscription{
+		lot:      pl,
+		observer: observer,
+		opts:     opts,
+		queue:    make(chan Event, opts.Buffer),
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	go s.run()
+	pl.subs = append(pl.subs, s)
+	return s
+}
+
+// Unsubscribe stops delivery to s. Events already queued are delivered
+// before it returns, so callers can rely on having seen them.
+func (pl *ParkingLot) Unsubscribe(s *Subscription) {
+	pl.mu.Lock()
+	for i, sub := range pl.subs {
+		if sub == s {
+			pl.subs = append(pl.subs[:i:i], pl.subs[i+1:]...)
+			break
+		}
+	}
+	if pl.observers == s {
+		pl.observers = nil // started again by the next event
+	}
+	pl.mu.Unlock()
+
+	s.once.Do(func() { close(s.done) })
+	<-s.exited
+}
+
+// Close unsubscribes every subscriber of the lot.
+func (pl *ParkingLot) Close() {
+	pl.mu.RLock()
+	subs := append([]*Subscription(nil), pl.subs...)
+	pl.mu.RUnlock()
+
+	for _, s := range subs {
+		pl.Unsubscribe(s)
+	}
+}
+
+func (s *Subscription) Unsubscribe() { s.lot.Unsubscribe(s) }
+
+// Dropped counts events discarded by the overflow policy.
+func (s *Subscription) Dropped() uint64 { return s.dropped.Load() }
+
+func (s *Subscription) send(e Event) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	switch s.opts.Policy {
+	case OverflowBlock:
+		select {
+		case s.queue <- e:
+		case <-s.done:
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.queue <- e:
+				return
+			default:
+			}
+			select {
+			case <-s.queue:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.queue <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+func (s *Subscription) run() {
+	defer close(s.exited)
+	for {
+		select {
+		case e := <-s.queue:
+			s.deliver(e)
+		case <-s.done:
+			for {
+				select {
+				case e := <-s.queue:
+					s.deliver(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Subscription) deliver(e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			if s.opts.OnPanic != nil {
+				s.opts.OnPanic(r, e)
+			} else {
+				log.Printf("parking lot %s: observer panicked on %s event: %v", e.Lot, e.Kind, r)
+			}
+		}
+	}()
+	s.observer.OnEvent(e)
+}
+
+// callSafely runs a synchronous observer, keeping a panic inside it from
+// unwinding into the lot's caller.
+func callSafely(lot string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("parking lot %s: observer panicked: %v", lot, r)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,177 @@
+// subscribe_test.go
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (l *eventLog) OnEvent(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *eventLog) plates(kind EventKind) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var plates []string
+	for _, e := range l.events {
+		if e.Kind == kind {
+			plates = append(plates, e.Plate)
+		}
+	}
+	return plates
+}
+
+func TestSlowSubscriberDoesNotStallGate(t *testing.T) {
+	lot := NewParkingLot("Lot A", 20)
+	release := make(chan struct{})
+	slow := lot.Subscribe(EventObserverFunc(func(Event) { <-release }), SubscribeOptions{Buffer: 2})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			_, _ = lot.ParkCar(&Car{Number: fmt.Sprintf("S%d", i)})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("parking stalled behind a slow subscriber")
+	}
+
+	close(release)
+	slow.Unsubscribe()
+	if slow.Dropped() == 0 {
+		t.Error("expected the slow subscriber's overflow to be dropped")
+	}
+}
+
+func TestDropOldestKeepsLatestEvents(t *testing.T) {
+	lot := NewParkingLot("Lot A", 10)
+	gate := make(chan struct{})
+	log := &eventLog{}
+	sub := lot.Subscribe(EventObserverFunc(func(e Event) {
+		<-gate
+		log.OnEvent(e)
+	}), SubscribeOptions{Buffer: 2, Policy: OverflowDropOldest})
+
+	for i := 0; i < 6; i++ {
+		_, _ = lot.ParkCar(&Car{Number: fmt.Sprintf("D%d", i)})
+	}
+	close(gate)
+	sub.Unsubscribe()
+
+	plates := log.plates(EventParked)
+	if len(plates) == 0 || plates[len(plates)-1] != "D5" {
+		t.Errorf("expected the latest event D5 to survive, got %v", plates)
+	}
+}
+
+func TestPanickingSubscriberIsIsolated(t *testing.T) {
+	lot := NewParkingLot("Lot A", 5)
+	panics := make(chan any, 10)
+	bad := lot.Subscribe(EventObserverFunc(func(Event) { panic("display board offline") }),
+		SubscribeOptions{OnPanic: func(r any, e Event) { panics <- r }})
+	good := &eventLog{}
+	goodSub := lot.Subscribe(good, SubscribeOptions{Policy: OverflowBlock})
+
+	_, _ = lot.ParkCar(&Car{Number: "P1"})
+	_, _ = lot.ParkCar(&Car{Number: "P2"})
+	bad.Unsubscribe()
+	goodSub.Unsubscribe()
+
+	if got := good.plates(EventParked); len(got) != 2 {
+		t.Errorf("expected healthy subscriber to see both parks, got %v", got)
+	}
+	if len(panics) != 2 {
+		t.Errorf("expected 2 recovered panics, got %d", len(panics))
+	}
+}
+
+func TestUnsubscribeStopsDelivery(t *testing.T) {
+	lot := NewParkingLot("Lot A", 5)
+	log := &eventLog{}
+	sub := lot.Subscribe(log, SubscribeOptions{})
+
+	_, _ = lot.ParkCar(&Car{Number: "U1"})
+	lot.Unsubscribe(sub)
+	_, _ = lot.ParkCar(&Car{Number: "U2"})
+
+	if got := log.plates(EventParked); len(got) != 1 || got[0] != "U1" {
+		t.Errorf("expected only U1 before unsubscribe, got %v", got)
+	}
+}
+
+func TestSubscribersSeeEventsInOrderUnderConcurrency(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4)) // gates must really overlap
+	lot := NewParkingLot("Lot A", 1)
+	log := &eventLog{}
+	sub := lot.Subscribe(log, SubscribeOptions{Buffer: 10000, Policy: OverflowBlock})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				plate := fmt.Sprintf("C%d-%d", g, i)
+				if _, err := lot.ParkCar(&Car{Number: plate}); err == nil {
+					_, _ = lot.UnparkCar(plate)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	sub.Unsubscribe()
+
+	occupied := 0
+	for _, e := range log.events {
+		switch e.Kind {
+		case EventParked:
+			occupied++
+		case EventUnparked:
+			occupied--
+		default:
+			continue
+		}
+		if e.Occupied != occupied {
+			t.Fatalf("events out of order: %s %s reports %d occupied after %d", e.Kind, e.Plate, e.Occupied, occupied)
+		}
+	}
+	if occupied != 0 {
+		t.Errorf("expected every park to be followed by its unpark, %d left", occupied)
+	}
+}
+
+func TestSlowObserverDoesNotStallGate(t *testing.T) {
+	lot := NewParkingLot("Lot A", 5)
+	release := make(chan struct{})
+	lot.AddEventObserver(EventObserverFunc(func(Event) { <-release }))
+	lot.AddObserver(func(string) { <-release })
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			_, _ = lot.ParkCar(&Car{Number: fmt.Sprintf("O%d", i)})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("parking stalled behind a slow observer")
+	}
+	close(release)
+	lot.flushObservers()
+}
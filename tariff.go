@@ -0,0 +1,254 @@
+// tariff.go
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// LineKind sorts fee lines into the parts of a receipt's breakdown.
+type LineKind string
+
+const (
+	LineBase     LineKind = "base" // parking time, surcharges and booking fees
+	LineDiscount LineKind = "discount"
+	LinePenalty  LineKind = "penalty"
+	LineTax      LineKind = "tax"
+	LineRounding LineKind = "rounding"
+)
+
+type FeeLine struct {
+	Kind        LineKind
+	Description string
+	Amount      Money
+}
+
+// FeeQuote is an itemized fee; Total is always the sum of the line amounts.
+type FeeQuote struct {
+	Plate     string
+	Entry     time.Time
+	Exit      time.Time
+	Duration  time.Duration
+	Lines     []FeeLine
+	Total     Money
+	Breakdown FeeBreakdown // filled in by the lot once taxes are applied
+}
+
+// FeeBreakdown totals a quote's lines by kind. Discounts are negative.
+type FeeBreakdown struct {
+	Base      Money
+	Discounts Money
+	Penalties Money
+	Tax       Money
+	Rounding  Money
+	Total     Money
+}
+
+func (q *FeeQuote) add(kind LineKind, description string, amount Money) {
+	q.Lines = append(q.Lines, FeeLine{Kind: kind, Description: description, Amount: amount})
+	q.Total = q.Total.Add(amount)
+}
+
+func (q *FeeQuote) breakdown() FeeBreakdown {
+	zero := Money{Currency: q.Total.Currency}
+	b := FeeBreakdown{Base: zero, Discounts: zero, Penalties: zero, Tax: zero, Rounding: zero, Total: q.Total}
+	for _, line := range q.Lines {
+		switch line.Kind {
+		case LineDiscount:
+			b.Discounts = b.Discounts.Add(line.Amount)
+		case LinePenalty:
+			b.Penalties = b.Penalties.Add(line.Amount)
+		case LineTax:
+			b.Tax = b.Tax.Add(line.Amount)
+		case LineRounding:
+			b.Rounding = b.Rounding.Add(line.Amount)
+		default:
+			b.Base = b.Base.Add(line.Amount)
+		}
+	}
+	return b
+}
+
+type Tariff interface {
+	Quote(car Car, entry, exit time.Time) FeeQuote
+}
+
+// PerMinuteTariff is the original flat tariff: whole minutes times the
+// rate, with a minimum number of billed minutes. With ProRata the part
+// minute is billed too, to the paisa. Amounts are in whole rupees.
+type PerMinuteTariff struct {
+	RatePerMinute     int
+	MinimumMinutes    int
+	ProRata           bool
+	LostTicket        int // penalty added by UnparkLostTicket
+	ReservationCharge int // added to the exit fee of a car that parked on a reservation
+	NoShowCharge      int // charged when a reservation expires unused
+}
+
+var DefaultTariff Tariff = PerMinuteTariff{RatePerMinute: 2, MinimumMinutes: 1}
+
+func (t PerMinuteTariff) Quote(car Car, entry, exit time.Time) FeeQuote {
+	q := newQuote(car, entry, exit)
+	minimum := time.Duration(t.MinimumMinutes) * time.Minute
+	if t.ProRata && q.Duration > minimum {
+		seconds := int64(q.Duration / time.Second)
+		fee := Paise(divRound(seconds*int64(t.RatePerMinute)*100, 60, RoundHalfUp))
+		q.add(LineBase, fmt.Sprintf("%s @ ₹%d/min", q.Duration.Truncate(time.Second), t.RatePerMinute), fee)
+		return q
+	}
+	minutes := int(q.Duration.Minutes())
+	if minutes < t.MinimumMinutes {
+		minutes = t.MinimumMinutes
+	}
+	q.add(LineBase, fmt.Sprintf("%d min @ ₹%d/min", minutes, t.RatePerMinute), Rupees(minutes*t.RatePerMinute))
+	return q
+}
+
+func newQuote(car Car, entry, exit time.Time) FeeQuote {
+	d := exit.Sub(entry)
+	if d < 0 {
+		d = 0
+	}
+	return FeeQuote{Plate: car.Number, Entry: entry, Exit: exit, Duration: d}
+}
+
+// HourlySlab bills Hours started hours at PerHour. A slab with Hours == 0,
+// or the last slab in a list, covers every remaining hour.
+type HourlySlab struct {
+	Hours   int
+	PerHour int
+}
+
+// RuleTariff bills per started hour. Each hour is priced from the slabs for
+// the car's size class (falling back to the "" entry), replaced by NightRate when
+// the hour starts inside the night window, and marked up by WeekendPercent
+// on Saturdays and Sundays. DailyCap limits each 24h block of the stay.
+// Rates and caps are in whole rupees; the surcharge is kept to the paisa.
+// Quote panics on a size class with no rate at all, which Validate catches.
+type RuleTariff struct {
+	Grace             time.Duration
+	Slabs             map[VehicleSize][]HourlySlab
+	DailyCap          int
+	NightRate         int
+	NightStart        int // hour of day, 0-23
+	NightEnd          int // hour of day, exclusive; may wrap past midnight
+	WeekendPercent    int
+	LostTicket        int // penalty added by UnparkLostTicket
+	ReservationCharge int // added to the exit fee of a car that parked on a reservation
+	NoShowCharge      int // charged when a reservation expires unused
+}
+
+func (t RuleTariff) Quote(car Car, entry, exit time.Time) FeeQuote {
+	q := newQuote(car, entry, exit)
+	if q.Duration <= t.Grace {
+		q.add(LineBase, "Grace period", Money{})
+		return q
+	}
+
+	slabs := t.Slabs[car.Size.Class()]
+	if len(slabs) == 0 {
+		slabs = t.Slabs[""]
+	}
+	if len(slabs) == 0 {
+		// Validate refuses such a tariff; pricing the stay as free would
+		// hide the mistake.
+		panic(fmt.Sprintf("RuleTariff has no slabs for %s vehicles", car.Size.Class()))
+	}
+
+	hours := int((q.Duration + time.Hour - 1) / time.Hour)
+	var standardHours, nightHours int
+	var standard, night, surcharge, capped, dayTotal Money
+	for h := 0; h < hours; h++ {
+		start := entry.Add(time.Duration(h) * time.Hour)
+
+		rate := Rupees(slabRate(slabs, h))
+		if t.NightRate > 0 && t.isNight(start.Hour()) {
+			rate = Rupees(t.NightRate)
+			nightHours++
+			night = night.Add(rate)
+		} else {
+			standardHours++
+			standard = standard.Add(rate)
+		}
+		if wd := start.Weekday(); t.WeekendPercent > 0 && (wd == time.Saturday || wd == time.Sunday) {
+			extra := rate.Percent(t.WeekendPercent * 100)
+			surcharge = surcharge.Add(extra)
+			rate = rate.Add(extra)
+		}
+
+		dayTotal = dayTotal.Add(rate)
+		if (h+1)%24 == 0 || h == hours-1 {
+			if limit := Rupees(t.DailyCap); t.DailyCap > 0 && dayTotal.Amount > limit.Amount {
+				capped = capped.Add(dayTotal.Sub(limit))
+			}
+			dayTotal = Money{}
+		}
+	}
+
+	if standardHours > 0 {
+		q.add(LineBase, fmt.Sprintf("%d standard hour(s)", standardHours), standard)
+	}
+	if nightHours > 0 {
+		q.add(LineBase, fmt.Sprintf("%d night hour(s) @ ₹%d/h", nightHours, t.NightRate), night)
+	}
+	if !surcharge.IsZero() {
+		q.add(LineBase, fmt.Sprintf("Weekend surcharge %d%%", t.WeekendPercent), surcharge)
+	}
+	if !capped.IsZero() {
+		q.add(LineDiscount, fmt.Sprintf("Daily cap ₹%d", t.DailyCap), capped.Neg())
+	}
+	return q
+}
+
+// Validate checks that every size class has a rate for every hour, either
+// from its own slabs or from the "" entry, and that the night window is
+// made of hours of the day.
+func (t RuleTariff) Validate() error {
+	if _, ok := t.Slabs[""]; !ok {
+		for _, class := range vehicleSizes {
+			if _, ok := t.Slabs[class]; !ok {
+				return fmt.Errorf("tariff Slabs: no rate for %s vehicles and no \"\" entry to fall back to", class)
+			}
+		}
+	}
+	for class, slabs := range t.Slabs {
+		if len(slabs) == 0 {
+			return fmt.Errorf("tariff Slabs: %q has no slabs", class)
+		}
+		for _, slab := range slabs {
+			if slab.Hours < 0 || slab.PerHour <= 0 {
+				return fmt.Errorf("tariff Slabs: %q: want Hours of 0 or more and a PerHour above 0, got %+v", class, slab)
+			}
+		}
+	}
+	if t.NightStart < 0 || t.NightStart > 23 || t.NightEnd < 0 || t.NightEnd > 23 {
+		return fmt.Errorf("tariff NightStart and NightEnd must be hours 0-23, got %d and %d", t.NightStart, t.NightEnd)
+	}
+	return nil
+}
+
+func (t RuleTariff) isNight(hour int) bool {
+	if t.NightStart == t.NightEnd {
+		return false
+	}
+	if t.NightStart < t.NightEnd {
+		return hour >= t.NightStart && hour < t.NightEnd
+	}
+	return hour >= t.NightStart || hour < t.NightEnd
+}
+
+// slabRate is the rate of the slab covering the hour; slabs must not be
+// empty.
+func slabRate(slabs []HourlySlab, hour int) int {
+	covered := 0
+	for _, slab := range slabs[:len(slabs)-1] {
+		if slab.Hours == 0 {
+			return slab.PerHour
+		}
+		covered += slab.Hours
+		if hour < covered {
+			return slab.PerHour
+		}
+	}
+	return slabs[len(slabs)-1].PerHour
+}
@@ -0,0 +1,97 @@
+// tariff_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var monday10am = time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+
+func TestRuleTariffGraceAndHourlySlabs(t *testing.T) {
+	tariff := RuleTariff{
+		Grace: 15 * time.Minute,
+		Slabs: map[VehicleSize][]HourlySlab{
+			"":        {{Hours: 2, PerHour: 20}, {PerHour: 30}},
+			SizeLarge: {{PerHour: 50}},
+		},
+	}
+
+	if q := tariff.Quote(Car{}, monday10am, monday10am.Add(10*time.Minute)); !q.Total.IsZero() {
+		t.Errorf("expected free stay inside grace, got %s", q.Total)
+	}
+	if q := tariff.Quote(Car{}, monday10am, monday10am.Add(3*time.Hour+10*time.Minute)); q.Total != Rupees(100) {
+		t.Errorf("expected ₹100 for 4 started hours (20+20+30+30), got %s: %+v", q.Total, q.Lines)
+	}
+	if q := tariff.Quote(Car{Size: SizeLarge}, monday10am, monday10am.Add(2*time.Hour)); q.Total != Rupees(100) {
+		t.Errorf("expected ₹100 for a large car over 2 hours, got %s", q.Total)
+	}
+}
+
+func TestRuleTariffNightWeekendAndDailyCap(t *testing.T) {
+	flat := map[VehicleSize][]HourlySlab{"": {{PerHour: 20}}}
+
+	night := RuleTariff{Slabs: flat, NightRate: 10, NightStart: 22, NightEnd: 6}
+	entry := time.Date(2024, 3, 4, 21, 0, 0, 0, time.UTC)
+	q := night.Quote(Car{}, entry, entry.Add(3*time.Hour+30*time.Minute))
+	if q.Total != Rupees(50) || len(q.Lines) != 2 {
+		t.Errorf("expected ₹50 as 1 standard + 3 night hours, got %s: %+v", q.Total, q.Lines)
+	}
+
+	weekend := RuleTariff{Slabs: flat, WeekendPercent: 50}
+	saturday := time.Date(2024, 3, 9, 10, 0, 0, 0, time.UTC)
+	if q := weekend.Quote(Car{}, saturday, saturday.Add(2*time.Hour)); q.Total != Rupees(60) {
+		t.Errorf("expected ₹60 with weekend surcharge, got %s", q.Total)
+	}
+
+	capped := RuleTariff{Slabs: flat, DailyCap: 100}
+	q = capped.Quote(Car{}, monday10am, monday10am.Add(30*time.Hour))
+	if q.Total != Rupees(200) {
+		t.Errorf("expected two capped days of ₹100, got %s: %+v", q.Total, q.Lines)
+	}
+}
+
+func TestLotUsesConfiguredTariffForQuoteAndCharge(t *testing.T) {
+	clock := NewFakeClock(monday10am)
+	lot := NewParkingLot("Lot A", 1)
+	lot.SetClock(clock)
+	lot.SetTariff(RuleTariff{Slabs: map[VehicleSize][]HourlySlab{"": {{PerHour: 40}}}})
+
+	_, _ = lot.ParkCar(&Car{Number: "KA01TT0001"})
+	clock.Advance(90 * time.Minute)
+
+	quote, err := lot.QuoteFee("KA01TT0001")
+	if err != nil || quote.Total != Rupees(80) {
+		t.Fatalf("expected ₹80 quote, got %s (err %v)", quote.Total, err)
+	}
+
+	_, fee, err := lot.UnparkCarAndCharge("KA01TT0001")
+	if err != nil || fee != 80 {
+		t.Errorf("expected ₹80 charge, got ₹%d (err %v)", fee, err)
+	}
+}
+
+func TestRuleTariffRefusesToPriceAClassWithoutSlabs(t *testing.T) {
+	tariff := RuleTariff{Slabs: map[VehicleSize][]HourlySlab{SizeLarge: {{PerHour: 50}}, SizeRegular: {}}}
+	if err := tariff.Validate(); err == nil {
+		t.Error("expected a tariff without rates for every class to be invalid")
+	}
+	for _, size := range []VehicleSize{SizeCompact, SizeRegular} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected no %s rate to be an error rather than a free stay", size)
+				}
+			}()
+			tariff.Quote(Car{Size: size}, monday10am, monday10am.Add(5*time.Hour))
+		}()
+	}
+
+	everyClass := make(map[VehicleSize][]HourlySlab)
+	for _, class := range vehicleSizes {
+		everyClass[class] = []HourlySlab{{PerHour: 40}}
+	}
+	if err := (RuleTariff{Slabs: everyClass}).Validate(); err != nil {
+		t.Errorf("expected slabs for every class to be enough without a fallback: %v", err)
+	}
+}
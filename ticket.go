@@ -0,0 +1,204 @@
+// ticket.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidTicket  = errors.New("invalid ticket")
+	ErrTicketUsed     = errors.New("ticket already used")
+	ErrTicketMismatch = errors.New("ticket does not match vehicle")
+)
+
+// Ticket is issued on every park. The lot keeps only the ID on the slot;
+// the rest is derived from the slot and the parked car.
+type Ticket struct {
+	ID        string
+	Lot       string
+	Slot      int
+	Plate     string
+	EntryTime time.Time
+	Attendant string
+	Lost      bool      `json:",omitempty"` // set on tickets closed by UnparkLostTicket
+	ExitTime  time.Time `json:",omitzero"`  // set once the ticket is closed
+}
+
+// ClosedTicketRetention is how long a used ticket is remembered, and so
+// refused with ErrTicketUsed rather than ErrInvalidTicket.
+const ClosedTicketRetention = 30 * 24 * time.Hour
+
+// LostTicketPricer is implemented by tariffs that add a penalty when the
+// driver cannot produce a ticket.
+type LostTicketPricer interface {
+	LostTicketPenalty(car Car) int
+}
+
+func (t PerMinuteTariff) LostTicketPenalty(Car) int { return t.LostTicket }
+func (t RuleTariff) LostTicketPenalty(Car) int      { return t.LostTicket }
+
+func newTicketID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("ticket id: %v", err))
+	}
+	return "T-" + hex.EncodeToString(b)
+}
+
+func (pl *ParkingLot) ticketLocked(i int) Ticket {
+	slot := pl.Slots[i]
+	return Ticket{
+		ID:        slot.TicketID,
+		Lot:       pl.Name,
+		Slot:      slot.Number,
+		Plate:     slot.Car.Number,
+		EntryTime: slot.Car.ParkedAt,
+		Attendant: slot.AttendantName,
+	}
+}
+
+func (pl *ParkingLot) issueTicketLocked(i int, id string) {
+	pl.Slots[i].TicketID = id
+	pl.indexLocked().byTicket[id] = i
+}
+
+// TicketFor returns the open ticket of a parked car, e.g. to print it
+// after one of the park paths that only return a slot number.
+func (pl *ParkingLot) TicketFor(carNumber string) (Ticket, error) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	i := pl.findLocked(carNumber)
+	if i < 0 {
+		return Ticket{}, pl.errorf(carNumber, ErrCarNotFound)
+	}
+	return pl.ticketLocked(i), nil
+}
+
+func (pl *ParkingLot) ParkCarWithTicket(car *Car) (Ticket, error) {
+	return pl.parkForTicket(car, "", nil)
+}
+
+func (a *Attendant) ParkCarWithTicket(car *Car) (Ticket, error) {
+	return a.Lot.parkForTicket(car, a.Name, a.Allocator)
+}
+
+func (pl *ParkingLot) parkForTicket(car *Car, attendantName string, allocator SlotAllocator) (ticket Ticket, err error) {
+	pl.update(func() {
+		if _, err = pl.parkAndCommitLocked(car, attendantName, allocator); err == nil {
+			ticket = pl.ticketLocked(pl.idx.byPlate[car.Number])
+		}
+	})
+	return ticket, err
+}
+
+// UnparkByTicket checks the ticket out of the lot and charges the stay.
+// plate is optional; when given it must match the car the ticket was
+// issued to. A ticket that was already used is rejected with ErrTicketUsed.
+func (pl *ParkingLot) UnparkByTicket(ticketID, plate string) (Ticket, FeeQuote, error) {
+	return pl.unpark(exitRequest{ticketID: ticketID, plate: plate, charge: true})
+}
+
+// UnparkLostTicket lets a car out without its ticket. The tariff's
+// lost-ticket penalty is added to the fee and the ticket is closed, so it
+// is refused if it turns up later.
+func (pl *ParkingLot) UnparkLostTicket(plate string) (Ticket, FeeQuote, error) {
+	return pl.unpark(exitRequest{plate: plate, charge: true, lostTicket: true})
+}
+
+type exitRequest struct {
+	plate      string
+	ticketID   string
+	charge     bool
+	lostTicket bool
+	quote      *FeeQuote // the price already paid, for the second phase of PayAndUnpark
+	payment    *Payment
+}
+
+// exitSlotLocked finds the head slot the request refers to. A car whose
+// payment is in progress can only leave through that payment.
+func (pl *ParkingLot) exitSlotLocked(req exitRequest) (int, error) {
+	i, err := pl.findExitLocked(req)
+	if err == nil && req.payment == nil && pl.checkouts[pl.Slots[i].TicketID] {
+		return -1, pl.errorf(pl.Slots[i].Car.Number, ErrPaymentPending)
+	}
+	return i, err
+}
+
+func (pl *ParkingLot) findExitLocked(req exitRequest) (int, error) {
+	if req.ticketID == "" {
+		i := pl.findLocked(req.plate)
+		if i < 0 {
+			return -1, pl.errorf(req.plate, ErrCarNotFound)
+		}
+		return i, nil
+	}
+
+	if closed, ok := pl.closedTickets[req.ticketID]; ok {
+		return -1, pl.errorf(closed.Plate, fmt.Errorf("%w: %s", ErrTicketUsed, req.ticketID))
+	}
+	i, ok := pl.indexLocked().byTicket[req.ticketID]
+	if !ok || pl.Slots[i].IsEmpty || pl.Slots[i].TicketID != req.ticketID {
+		return -1, pl.errorf(req.plate, fmt.Errorf("%w: %s", ErrInvalidTicket, req.ticketID))
+	}
+	if req.plate != "" && pl.Slots[i].Car.Number != req.plate {
+		return -1, pl.errorf(req.plate, fmt.Errorf("%w: %s was issued to %s", ErrTicketMismatch, req.ticketID, pl.Slots[i].Car.Number))
+	}
+	return i, nil
+}
+
+// closeTicketLocked remembers a used ticket, forgetting those closed more
+// than ClosedTicketRetention ago. Tickets close in exit order, so the
+// expired ones are at the front of the queue.
+func (pl *ParkingLot) closeTicketLocked(ticket Ticket) {
+	if ticket.ID == "" {
+		return
+	}
+	if pl.closedTickets == nil {
+		pl.closedTickets = make(map[string]Ticket)
+	}
+	pl.closedTickets[ticket.ID] = ticket
+	pl.closedQueue = append(pl.closedQueue, ticket)
+	cutoff := ticket.ExitTime.Add(-ClosedTicketRetention)
+	for len(pl.closedQueue) > 0 && pl.closedQueue[0].ExitTime.Before(cutoff) {
+		old := pl.closedQueue[0]
+		if kept, ok := pl.closedTickets[old.ID]; ok && kept.ExitTime.Equal(old.ExitTime) {
+			delete(pl.closedTickets, old.ID)
+		}
+		pl.closedQueue = pl.closedQueue[1:]
+	}
+}
+
+// ClosedTicketStore is implemented by stores that keep used tickets apart
+// from the lot snapshots, so a park or unpark never rewrites them.
+type ClosedTicketStore interface {
+	SaveClosedTicket(lot string, ticket Ticket) error
+	ClosedTickets(lot string) ([]Ticket, error) // oldest first
+}
+
+func (pl *ParkingLot) saveClosedTicketLocked(ticket Ticket) error {
+	cs, ok := pl.Store.(ClosedTicketStore)
+	if !ok {
+		return nil
+	}
+	if err := cs.SaveClosedTicket(pl.Name, ticket); err != nil {
+		return fmt.Errorf("%w: %v", ErrPersist, err)
+	}
+	return nil
+}
+
+func (pl *ParkingLot) lostTicketLine(quote *FeeQuote, car Car) {
+	tariff := pl.Tariff
+	if tariff == nil {
+		tariff = DefaultTariff
+	}
+	if pricer, ok := tariff.(LostTicketPricer); ok {
+		if penalty := pricer.LostTicketPenalty(car); penalty > 0 {
+			quote.add(LinePenalty, "Lost ticket penalty", Rupees(penalty))
+		}
+	}
+}
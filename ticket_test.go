@@ -0,0 +1,161 @@
+// ticket_test.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParkIssuesTicketAndUnparkByTicketCharges(t *testing.T) {
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	lot := NewParkingLot("Lot A", 3)
+	lot.SetClock(clock)
+
+	attendant := &Attendant{Name: "Ravi", Lot: lot}
+	ticket, err := attendant.ParkCarWithTicket(&Car{Number: "TK1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.ID == "" || ticket.Lot != "Lot A" || ticket.Slot != 1 || ticket.Plate != "TK1" ||
+		!ticket.EntryTime.Equal(start) || ticket.Attendant != "Ravi" {
+		t.Fatalf("unexpected ticket %+v", ticket)
+	}
+
+	// Tickets are issued on the plain park paths too.
+	if _, err := lot.ParkCar(&Car{Number: "TK2"}); err != nil {
+		t.Fatal(err)
+	}
+	other, err := lot.TicketFor("TK2")
+	if err != nil || other.ID == "" || other.ID == ticket.ID {
+		t.Fatalf("expected a distinct ticket for TK2, got %+v (err %v)", other, err)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if _, _, err := lot.UnparkByTicket(ticket.ID, "TK2"); !errors.Is(err, ErrTicketMismatch) {
+		t.Errorf("expected ErrTicketMismatch, got %v", err)
+	}
+	if _, _, err := lot.UnparkByTicket("T-bogus", ""); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("expected ErrInvalidTicket, got %v", err)
+	}
+
+	closed, quote, err := lot.UnparkByTicket(ticket.ID, "TK1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed.ID != ticket.ID || quote.Total != Rupees(20) {
+		t.Errorf("expected ticket %s charged 20, got %+v fee %s", ticket.ID, closed, quote.Total)
+	}
+
+	_, _, err = lot.UnparkByTicket(ticket.ID, "")
+	var lotErr *LotError
+	if !errors.Is(err, ErrTicketUsed) || !errors.As(err, &lotErr) || lotErr.Plate != "TK1" {
+		t.Errorf("expected ErrTicketUsed naming TK1, got %v", err)
+	}
+}
+
+func TestLostTicketAddsPenaltyAndVoidsTicket(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	lot := NewParkingLot("Lot A", 2)
+	lot.SetClock(clock)
+	lot.SetTariff(PerMinuteTariff{RatePerMinute: 2, MinimumMinutes: 1, LostTicket: 500})
+
+	ticket, err := lot.ParkCarWithTicket(&Car{Number: "LT1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Minute)
+
+	closed, quote, err := lot.UnparkLostTicket("LT1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !closed.Lost || quote.Total != Rupees(560) {
+		t.Errorf("expected lost ticket charged 60+500, got %+v fee %s", closed, quote.Total)
+	}
+	if last := quote.Lines[len(quote.Lines)-1]; last.Description != "Lost ticket penalty" || last.Amount != Rupees(500) {
+		t.Errorf("expected penalty line, got %+v", quote.Lines)
+	}
+
+	// The car is back under a new ticket; the lost one must not let it out.
+	if _, err := lot.ParkCar(&Car{Number: "LT1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := lot.UnparkByTicket(ticket.ID, "LT1"); !errors.Is(err, ErrTicketUsed) {
+		t.Errorf("expected found ticket to be rejected, got %v", err)
+	}
+}
+
+func TestReplayRestoresTickets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	manager := journaledManager(t, path, clock)
+	lot := manager.Lots[0]
+
+	open, _ := lot.ParkCarWithTicket(&Car{Number: "RT1"})
+	used, _ := lot.ParkCarWithTicket(&Car{Number: "RT2"})
+	if _, _, err := lot.UnparkByTicket(used.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := ReplayFile(path, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket, err := replayed.Lots[0].TicketFor("RT1"); err != nil || ticket != open {
+		t.Errorf("expected ticket %+v after replay, got %+v (err %v)", open, ticket, err)
+	}
+	if _, _, err := replayed.Lots[0].UnparkByTicket(used.ID, ""); !errors.Is(err, ErrTicketUsed) {
+		t.Errorf("expected used ticket to stay used after replay, got %v", err)
+	}
+}
+
+func TestUsedTicketRefusedAfterRestart(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := NewFakeClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	lot := NewParkingLot("Lot A", 2)
+	lot.SetClock(clock)
+	lot.SetStore(store)
+	old, _ := lot.ParkCarWithTicket(&Car{Number: "RS1"})
+	lot.UnparkByTicket(old.ID, "")
+	clock.Advance(ClosedTicketRetention + time.Hour)
+	used, _ := lot.ParkCarWithTicket(&Car{Number: "RS2"})
+	if _, _, err := lot.UnparkByTicket(used.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadParkingLot(store, "Lot A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := reloaded.UnparkByTicket(used.ID, ""); !errors.Is(err, ErrTicketUsed) {
+		t.Errorf("expected the used ticket refused after a restart, got %v", err)
+	}
+	if _, _, err := reloaded.UnparkByTicket(old.ID, ""); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("expected a ticket past retention to be forgotten, got %v", err)
+	}
+
+	// Used tickets stay out of the lot file every park and unpark rewrites.
+	if snapshot, err := os.ReadFile(store.path("Lot A")); err != nil || bytes.Contains(snapshot, []byte(used.ID)) {
+		t.Errorf("expected %s kept out of the lot snapshot (err %v)", used.ID, err)
+	}
+	// A ticket saved just before an exit that then failed is still the car's.
+	parked, _ := reloaded.ParkCarWithTicket(&Car{Number: "RS3"})
+	if err := store.SaveClosedTicket("Lot A", parked); err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadParkingLot(store, "Lot A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := again.UnparkByTicket(parked.ID, ""); err != nil {
+		t.Errorf("expected the still-parked car to leave on its ticket, got %v", err)
+	}
+}
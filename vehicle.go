@@ -0,0 +1,79 @@
+// vehicle.go
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VehicleSize classifies both cars and slots. A vehicle fits any slot of
+// its own class or larger; buses only fit bus slots, or a run of adjacent
+// large slots when the lot allows spanning.
+type VehicleSize string
+
+const (
+	SizeMotorcycle VehicleSize = "motorcycle"
+	SizeCompact    VehicleSize = "compact"
+	SizeSmall      VehicleSize = "small" // legacy name for SizeCompact
+	SizeRegular    VehicleSize = "regular"
+	SizeLarge      VehicleSize = "large"
+	SizeBus        VehicleSize = "bus"
+)
+
+var vehicleSizes = []VehicleSize{SizeMotorcycle, SizeCompact, SizeRegular, SizeLarge, SizeBus}
+
+const numSizeClasses = 5 // len(vehicleSizes), the range of rank()
+
+func ParseVehicleSize(s string) (VehicleSize, error) {
+	size := VehicleSize(strings.ToLower(strings.TrimSpace(s)))
+	if size == "" || size == SizeSmall {
+		return size.Class(), nil
+	}
+	for _, known := range vehicleSizes {
+		if size == known {
+			return size, nil
+		}
+	}
+	return "", fmt.Errorf("unknown vehicle size %q", s)
+}
+
+// Class folds the legacy and unset sizes onto the five canonical classes:
+// "small" is compact and an unset size is treated as a regular car.
+func (s VehicleSize) Class() VehicleSize {
+	switch s {
+	case SizeSmall:
+		return SizeCompact
+	case "":
+		return SizeRegular
+	}
+	return s
+}
+
+func (s VehicleSize) rank() int {
+	switch s.Class() {
+	case SizeMotorcycle:
+		return 0
+	case SizeCompact:
+		return 1
+	case SizeRegular:
+		return 2
+	case SizeLarge:
+		return 3
+	case SizeBus:
+		return 4
+	}
+	return 2
+}
+
+// slotClass is the class a slot accepts; unsized slots take anything up to
+// a large vehicle, which matches how lots behaved before slots had sizes.
+func slotClass(s VehicleSize) VehicleSize {
+	if s == "" {
+		return SizeLarge
+	}
+	return s.Class()
+}
+
+func (s VehicleSize) FitsIn(slot VehicleSize) bool {
+	return s.rank() <= slotClass(slot).rank()
+}
@@ -0,0 +1,87 @@
+// vehicle_test.go
+package main
+
+import "testing"
+
+func TestParseVehicleSize(t *testing.T) {
+	cases := map[string]VehicleSize{
+		"Bus": SizeBus, "small": SizeCompact, "": SizeRegular, " motorcycle ": SizeMotorcycle,
+	}
+	for in, want := range cases {
+		got, err := ParseVehicleSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseVehicleSize(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseVehicleSize("spaceship"); err == nil {
+		t.Error("expected error for unknown size")
+	}
+}
+
+func TestParkCarOnlyUsesCompatibleSlots(t *testing.T) {
+	lot := NewParkingLotWithSizes("Lot A", SizeMotorcycle, SizeCompact, SizeLarge)
+
+	slot, err := lot.ParkCar(&Car{Number: "TRUCK1", Size: SizeLarge})
+	if err != nil || slot != 3 {
+		t.Fatalf("expected large vehicle in slot 3, got %d (err %v)", slot, err)
+	}
+	slot, err = lot.ParkCar(&Car{Number: "CAR1", Size: SizeCompact})
+	if err != nil || slot != 2 {
+		t.Fatalf("expected compact car in slot 2, got %d (err %v)", slot, err)
+	}
+	if _, err := lot.ParkCar(&Car{Number: "CAR2", Size: SizeRegular}); err == nil {
+		t.Error("expected regular car to be refused by a motorcycle slot")
+	}
+	slot, err = lot.ParkCar(&Car{Number: "BIKE1", Size: SizeMotorcycle})
+	if err != nil || slot != 1 {
+		t.Errorf("expected motorcycle in slot 1, got %d (err %v)", slot, err)
+	}
+}
+
+// inOneRow puts every slot of the lot in row A, so slots next to each
+// other by number are next to each other on the ground.
+func inOneRow(lot *ParkingLot) *ParkingLot {
+	for i := range lot.Slots {
+		lot.Slots[i].Row, lot.Slots[i].Position = "A", i+1
+	}
+	return lot
+}
+
+func TestBusSpansAdjacentLargeSlots(t *testing.T) {
+	lot := inOneRow(NewParkingLotWithSizes("Depot", SizeLarge, SizeRegular, SizeLarge, SizeLarge, SizeLarge))
+	bus := &Car{Number: "BUS1", Size: SizeBus}
+
+	if _, err := lot.ParkCar(bus); err == nil {
+		t.Fatal("expected bus to be refused when spanning is disabled")
+	}
+
+	lot.BusSpan = 3
+	slot, err := lot.ParkCar(bus)
+	if err != nil || slot != 3 {
+		t.Fatalf("expected bus to span slots 3-5, got %d (err %v)", slot, err)
+	}
+	if got := len(lot.GetAllParkedCars()); got != 1 {
+		t.Errorf("expected the bus to be listed once, got %d entries", got)
+	}
+	if lot.FreeSlots() != 2 {
+		t.Errorf("expected 2 free slots while the bus is parked, got %d", lot.FreeSlots())
+	}
+
+	if _, err := lot.UnparkCar("BUS1"); err != nil {
+		t.Fatalf("unexpected unpark error: %v", err)
+	}
+	if lot.FreeSlots() != 5 {
+		t.Errorf("expected all spanned slots to be freed, got %d free", lot.FreeSlots())
+	}
+}
+
+func TestParkLargeVehicleSkipsLotsWithoutLargeSlots(t *testing.T) {
+	small := NewParkingLotWithSizes("Lot A", SizeCompact, SizeCompact, SizeCompact)
+	big := NewParkingLotWithSizes("Lot B", SizeCompact, SizeLarge)
+	manager := &ParkingManager{Lots: []*ParkingLot{small, big}}
+
+	lotName, slot, err := manager.ParkLargeVehicle(&Car{Number: "TRUCK2", Size: SizeLarge})
+	if err != nil || lotName != "Lot B" || slot != 2 {
+		t.Errorf("expected Lot B slot 2, got %s slot %d (err %v)", lotName, slot, err)
+	}
+}